@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	mh "github.com/multiformats/go-multihash"
+)
+
+func runDecode(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("decode", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: libp2px decode PEERID|MULTIADDR...\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	for _, arg := range fs.Args() {
+		var err error
+		if strings.HasPrefix(arg, "/") {
+			err = decodeAddr(arg, out)
+		} else {
+			err = decodePeer(arg, out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodePeer(s string, out io.Writer) error {
+	id, err := peer.Decode(s)
+	if err != nil {
+		return fmt.Errorf("invalid peer id %q: %v", s, err)
+	}
+	fmt.Fprintf(out, "peer id: %s\n", id.Pretty())
+	if dmh, err := mh.Decode([]byte(id)); err == nil {
+		fmt.Fprintf(out, "  multihash: %s\n", dmh.Name)
+	}
+	if pk, err := id.ExtractPublicKey(); err == nil && pk != nil {
+		fmt.Fprintf(out, "  public key: %s, inlined\n", pk.Type())
+	} else {
+		fmt.Fprintf(out, "  public key: hashed, fetch it through identify\n")
+	}
+	return nil
+}
+
+func decodeAddr(s string, out io.Writer) error {
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return fmt.Errorf("invalid multiaddr %q: %v", s, err)
+	}
+	fmt.Fprintf(out, "multiaddr: %s\n", addr)
+	ma.ForEach(addr, func(c ma.Component) bool {
+		fmt.Fprintf(out, "  %s %s\n", c.Protocol().Name, c.Value())
+		return true
+	})
+	if info, err := peer.AddrInfoFromP2pAddr(addr); err == nil {
+		fmt.Fprintf(out, "  peer id: %s\n", info.ID.Pretty())
+	}
+	return nil
+}
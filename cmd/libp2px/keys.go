@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"go.uber.org/zap"
+
+	libp2p "github.com/RTradeLtd/libp2px"
+	"github.com/RTradeLtd/libp2px/pkg/pnet"
+)
+
+// passphraseEnv names the environment variable holding the passphrase of
+// identity files, kept off the command line so it doesn't show in ps
+const passphraseEnv = "LIBP2PX_PASSPHRASE"
+
+var keyTypes = map[string]int{
+	"rsa":       crypto.RSA,
+	"ed25519":   crypto.Ed25519,
+	"secp256k1": crypto.Secp256k1,
+	"ecdsa":     crypto.ECDSA,
+}
+
+func runIdentity(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("identity", flag.ContinueOnError)
+	path := fs.String("out", "identity.key", "file to save the key to")
+	typ := fs.String("type", "ed25519", "key type: rsa, ed25519, secp256k1 or ecdsa")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: libp2px identity [flags]\n\n")
+		fmt.Fprintf(fs.Output(), "The key is encrypted with $%s if it is set.\n\n", passphraseEnv)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	kt, ok := keyTypes[strings.ToLower(*typ)]
+	if !ok {
+		return fmt.Errorf("unknown key type %q", *typ)
+	}
+	if _, err := os.Stat(*path); err == nil {
+		return fmt.Errorf("%s already exists", *path)
+	}
+
+	// IdentityFromFile generates and saves the key on first use
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := libp2p.New(ctx, zap.NewNop(),
+		libp2p.NoListenAddrs,
+		libp2p.NoTransports,
+		libp2p.IdentityFromFile(*path, os.Getenv(passphraseEnv)),
+		libp2p.KeyType(kt),
+	)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+	fmt.Fprintf(out, "peer id: %s\n", h.ID().Pretty())
+	fmt.Fprintf(out, "saved to: %s\n", *path)
+	return nil
+}
+
+func runPSK(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("psk", flag.ContinueOnError)
+	path := fs.String("out", "swarm.key", "file to save the key to")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	r, err := pnet.GenerateV1PSK()
+	if err != nil {
+		return err
+	}
+	key, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	prot, err := pnet.NewProtector(bytes.NewReader(key))
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(*path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(key); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "fingerprint: %x\n", prot.Fingerprint())
+	fmt.Fprintf(out, "saved to: %s\n", *path)
+	return nil
+}
+
+func runFingerprint(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("fingerprint", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: libp2px fingerprint KEYFILE...\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	for _, path := range fs.Args() {
+		prot, err := loadPSK(path)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s: %x\n", path, prot.Fingerprint())
+	}
+	return nil
+}
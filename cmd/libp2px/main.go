@@ -0,0 +1,70 @@
+// Command libp2px manages libp2px keys, inspects peer IDs and multiaddrs,
+// and runs diagnostics against other nodes. Its nodes are configured through
+// the public options of the libp2p package only, so the subcommands double
+// as a reference for configuring hosts.
+//
+// Usage:
+//
+//	libp2px <command> [flags] [args]
+//
+// Run a command with -h to list its flags.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(args []string, out io.Writer) error
+}
+
+var commands = []command{
+	{"identity", "generate a peer identity key", runIdentity},
+	{"psk", "generate a private network key and print its fingerprint", runPSK},
+	{"fingerprint", "print the fingerprint of a private network key", runFingerprint},
+	{"decode", "decode peer IDs and multiaddrs", runDecode},
+	{"listen", "run a listen-only node", runListen},
+	{"dial", "dial a peer and report the negotiated connection", runDial},
+	{"pubsub", "send and receive pubsub test messages", runPubSub},
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: libp2px <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-12s %s\n", c.name, c.summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:], os.Stdout); err != nil {
+				// the flag set already printed the usage
+				if err == flag.ErrHelp {
+					os.Exit(2)
+				}
+				fmt.Fprintf(os.Stderr, "libp2px %s: %v\n", c.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage(os.Stdout)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "libp2px: unknown command %q\n", os.Args[1])
+	usage(os.Stderr)
+	os.Exit(2)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPSKFingerprint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libp2px")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "swarm.key")
+
+	var out bytes.Buffer
+	if err := runPSK([]string{"-out", path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	fp := strings.TrimPrefix(strings.Split(out.String(), "\n")[0], "fingerprint: ")
+	if len(fp) != 32 {
+		t.Fatalf("unexpected fingerprint line in %q", out.String())
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("key file mode %v, want 0600", fi.Mode().Perm())
+	}
+	// never overwrite an existing key
+	if err := runPSK([]string{"-out", path}, &out); err == nil {
+		t.Fatal("overwrote an existing key")
+	}
+
+	out.Reset()
+	if err := runFingerprint([]string{path}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if want := path + ": " + fp + "\n"; out.String() != want {
+		t.Fatalf("fingerprint %q, want %q", out.String(), want)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	const id = "12D3KooWD3eckifWpRn9wQpMG9R9hX3sD158z7EqHWmweQAJU5SA"
+	var out bytes.Buffer
+	if err := runDecode([]string{id, "/ip4/127.0.0.1/tcp/4001/p2p/" + id}, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"peer id: " + id,
+		"multihash: identity",
+		"public key: Ed25519, inlined",
+		"ip4 127.0.0.1",
+		"tcp 4001",
+		"  peer id: " + id,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, out.String())
+		}
+	}
+	if err := runDecode([]string{"not-a-peer"}, &out); err == nil {
+		t.Fatal("decoded an invalid peer id")
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/host"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	ipnet "github.com/RTradeLtd/libp2px-core/pnet"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+
+	libp2p "github.com/RTradeLtd/libp2px"
+	"github.com/RTradeLtd/libp2px/pkg/admin"
+	"github.com/RTradeLtd/libp2px/pkg/identify"
+	"github.com/RTradeLtd/libp2px/pkg/metrics"
+	"github.com/RTradeLtd/libp2px/pkg/ping"
+	"github.com/RTradeLtd/libp2px/pkg/pnet"
+	"github.com/RTradeLtd/libp2px/pkg/swarm"
+)
+
+// nodeFlags are the flags shared by the commands running a node
+type nodeFlags struct {
+	config    string
+	identity  string
+	psk       string
+	listen    string
+	listenSet bool
+	verbose   bool
+}
+
+func (nf *nodeFlags) register(fs *flag.FlagSet, listen string) {
+	fs.StringVar(&nf.config, "config", "", "node config file, applied before the other flags")
+	fs.StringVar(&nf.identity, "identity", "", "identity key file, created if missing (default a random identity)")
+	fs.StringVar(&nf.psk, "psk", "", "private network key file")
+	fs.StringVar(&nf.listen, "listen", listen, "comma separated addresses to listen on, none if empty")
+	fs.BoolVar(&nf.verbose, "v", false, "log debug output")
+}
+
+func (nf *nodeFlags) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "listen" {
+			nf.listenSet = true
+		}
+	})
+	return nil
+}
+
+// options translates the flags to libp2p options. The config file comes
+// first so the flags override it.
+func (nf *nodeFlags) options() ([]libp2p.Option, error) {
+	// keys generated for the CLI are ed25519 unless the config says otherwise
+	opts := []libp2p.Option{libp2p.KeyType(crypto.Ed25519)}
+	if nf.config != "" {
+		copts, err := libp2p.LoadConfig(nf.config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, copts...)
+	}
+	if nf.identity != "" {
+		opts = append(opts, libp2p.IdentityFromFile(nf.identity, os.Getenv(passphraseEnv)))
+	}
+	if nf.psk != "" {
+		prot, err := loadPSK(nf.psk)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, libp2p.PrivateNetwork(prot))
+	}
+	// without an explicit -listen, the config file decides
+	if nf.listenSet || nf.config == "" {
+		if nf.listen == "" {
+			opts = append(opts, libp2p.NoListenAddrs)
+		} else {
+			opts = append(opts, libp2p.ListenAddrStrings(strings.Split(nf.listen, ",")...))
+		}
+	}
+	return opts, nil
+}
+
+func (nf *nodeFlags) newHost(ctx context.Context, extra ...libp2p.Option) (host.Host, error) {
+	logger := zap.NewNop()
+	if nf.verbose {
+		var err error
+		if logger, err = zap.NewDevelopment(); err != nil {
+			return nil, err
+		}
+	}
+	opts, err := nf.options()
+	if err != nil {
+		return nil, err
+	}
+	return libp2p.New(ctx, logger, append(opts, extra...)...)
+}
+
+func loadPSK(path string) (ipnet.Protector, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return pnet.NewProtector(f)
+}
+
+func waitForInterrupt() {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	signal.Stop(sig)
+}
+
+func runListen(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("listen", flag.ContinueOnError)
+	var nf nodeFlags
+	nf.register(fs, "/ip4/0.0.0.0/tcp/4001,/ip6/::/tcp/4001")
+	httpAddr := fs.String("http", "", "address serving /metrics and the /debug/ admin API (disabled if empty)")
+	nat := fs.Bool("nat", false, "map the listen ports on the NAT device")
+	if err := nf.parse(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := []libp2p.Option{libp2p.Ping(true), libp2p.Identify()}
+	if *nat {
+		opts = append(opts, libp2p.NATPortMap())
+	}
+	reg := metrics.NewRegistry()
+	if *httpAddr != "" {
+		opts = append(opts, libp2p.Metrics(reg))
+	}
+	h, err := nf.newHost(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	if *httpAddr != "" {
+		debug, err := admin.NewHandler(h)
+		if err != nil {
+			return err
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", reg.Handler())
+		mux.Handle("/debug/", http.StripPrefix("/debug", debug))
+		srv := &http.Server{Addr: *httpAddr, Handler: mux}
+		go func() {
+			if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+				fmt.Fprintf(os.Stderr, "libp2px listen: http: %v\n", err)
+			}
+		}()
+		defer srv.Close()
+	}
+
+	fmt.Fprintf(out, "peer id: %s\n", h.ID().Pretty())
+	p2p, err := ma.NewMultiaddr("/p2p/" + h.ID().Pretty())
+	if err != nil {
+		return err
+	}
+	for _, addr := range h.Addrs() {
+		fmt.Fprintf(out, "listening on: %s\n", addr.Encapsulate(p2p))
+	}
+	h.Network().Notify(&network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			fmt.Fprintf(out, "connected: %s via %s\n", c.RemotePeer().Pretty(), c.RemoteMultiaddr())
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			fmt.Fprintf(out, "disconnected: %s via %s\n", c.RemotePeer().Pretty(), c.RemoteMultiaddr())
+		},
+	})
+
+	waitForInterrupt()
+	return nil
+}
+
+func runDial(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("dial", flag.ContinueOnError)
+	var nf nodeFlags
+	nf.register(fs, "")
+	timeout := fs.Duration("timeout", 30*time.Second, "time allowed to connect")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: libp2px dial [flags] MULTIADDR/p2p/PEERID\n\n")
+		fs.PrintDefaults()
+	}
+	if err := nf.parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	addr, err := ma.NewMultiaddr(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return fmt.Errorf("the address must end with /p2p/PEERID: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	h, err := nf.newHost(ctx, libp2p.Identify(), libp2p.Ping(true))
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	// Connect covers the transport dial and the security and muxer
+	// handshakes
+	start := time.Now()
+	if err := h.Connect(ctx, *info); err != nil {
+		return err
+	}
+	took := time.Since(start)
+
+	conns := h.Network().ConnsToPeer(info.ID)
+	if len(conns) == 0 {
+		return fmt.Errorf("connection to %s closed", info.ID.Pretty())
+	}
+	c := conns[0]
+	fmt.Fprintf(out, "peer id: %s\n", info.ID.Pretty())
+	fmt.Fprintf(out, "address: %s\n", c.RemoteMultiaddr())
+	fmt.Fprintf(out, "transport: %s\n", metrics.TransportName(c.RemoteMultiaddr()))
+	if sc, ok := c.(*swarm.Conn); ok {
+		fmt.Fprintf(out, "security: %s\n", sc.Security())
+		fmt.Fprintf(out, "muxer: %s\n", sc.Muxer())
+	}
+	fmt.Fprintf(out, "handshake: %s\n", took)
+
+	if idh, ok := h.(interface{ IDService() *identify.IDService }); ok && idh.IDService() != nil {
+		select {
+		case <-idh.IDService().IdentifyWait(c):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if v, err := h.Peerstore().Get(info.ID, "AgentVersion"); err == nil {
+			fmt.Fprintf(out, "agent: %v\n", v)
+		}
+		if protos, err := h.Peerstore().GetProtocols(info.ID); err == nil && len(protos) > 0 {
+			fmt.Fprintf(out, "protocols: %s\n", strings.Join(protos, " "))
+		}
+	}
+	if supported, err := h.Peerstore().SupportsProtocols(info.ID, string(ping.ID)); err == nil && len(supported) > 0 {
+		pctx, pcancel := context.WithCancel(ctx)
+		res := <-ping.Ping(pctx, h, info.ID)
+		pcancel()
+		if res.Error != nil {
+			fmt.Fprintf(out, "ping: %v\n", res.Error)
+		} else {
+			fmt.Fprintf(out, "ping: %s\n", res.RTT)
+		}
+	}
+	return nil
+}
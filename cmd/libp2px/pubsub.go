@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+
+	"github.com/RTradeLtd/libp2px/pkg/pubsub"
+)
+
+func runPubSub(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("pubsub", flag.ContinueOnError)
+	var nf nodeFlags
+	nf.register(fs, "/ip4/0.0.0.0/tcp/0")
+	topicName := fs.String("topic", "libp2px-test", "topic to join")
+	connect := fs.String("connect", "", "comma separated MULTIADDR/p2p/PEERID to connect to")
+	router := fs.String("router", "gossipsub", "pubsub router: gossipsub or floodsub")
+	count := fs.Int("count", 0, "number of test messages to send, receive only if 0")
+	interval := fs.Duration("interval", time.Second, "interval between test messages")
+	linger := fs.Duration("linger", 2*time.Second, "time to keep receiving once the messages are sent")
+	if err := nf.parse(fs, args); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h, err := nf.newHost(ctx)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	var ps *pubsub.PubSub
+	switch *router {
+	case "gossipsub":
+		ps, err = pubsub.NewGossipSub(ctx, h)
+	case "floodsub":
+		ps, err = pubsub.NewFloodSub(ctx, h)
+	default:
+		err = fmt.Errorf("unknown router %q", *router)
+	}
+	if err != nil {
+		return err
+	}
+	topic, err := ps.Join(*topicName)
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "peer id: %s\n", h.ID().Pretty())
+	for _, addr := range h.Addrs() {
+		fmt.Fprintf(out, "listening on: %s/p2p/%s\n", addr, h.ID().Pretty())
+	}
+	if *connect != "" {
+		for _, s := range strings.Split(*connect, ",") {
+			addr, err := ma.NewMultiaddr(s)
+			if err != nil {
+				return err
+			}
+			info, err := peer.AddrInfoFromP2pAddr(addr)
+			if err != nil {
+				return err
+			}
+			if err := h.Connect(ctx, *info); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "connected: %s\n", info.ID.Pretty())
+		}
+	}
+
+	go func() {
+		for {
+			msg, err := sub.Next(ctx)
+			if err != nil {
+				return
+			}
+			if msg.ReceivedFrom == h.ID() {
+				continue
+			}
+			fmt.Fprintf(out, "received from %s: %s\n", msg.GetFrom().Pretty(), msg.GetData())
+		}
+	}()
+
+	if *count == 0 {
+		waitForInterrupt()
+		return nil
+	}
+
+	// wait for the subscriptions of our peers, so the first messages
+	// aren't published to nobody
+	if *connect != "" {
+		deadline := time.Now().Add(10 * time.Second)
+		for len(topic.ListPeers()) == 0 && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	for i := 1; i <= *count; i++ {
+		data := fmt.Sprintf("test message %d/%d from %s", i, *count, h.ID().Pretty())
+		if err := topic.Publish(ctx, []byte(data)); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "sent: %s\n", data)
+		if i < *count {
+			time.Sleep(*interval)
+		}
+	}
+	time.Sleep(*linger)
+	return nil
+}
@@ -19,7 +19,14 @@ import (
 	relay "github.com/RTradeLtd/libp2px/p2p/host/relay"
 	routed "github.com/RTradeLtd/libp2px/p2p/host/routed"
 
+	pconnmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
 	discovery "github.com/RTradeLtd/libp2px/pkg/discovery"
+	identify "github.com/RTradeLtd/libp2px/pkg/identify"
+	keystore "github.com/RTradeLtd/libp2px/pkg/keystore"
+	pmetrics "github.com/RTradeLtd/libp2px/pkg/metrics"
+	pstoreimpl "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	ping "github.com/RTradeLtd/libp2px/pkg/ping"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 	swarm "github.com/RTradeLtd/libp2px/pkg/swarm"
 	circuit "github.com/RTradeLtd/libp2px/pkg/transports/circuit"
 	tptu "github.com/RTradeLtd/libp2px/pkg/transports/upgrader"
@@ -50,6 +57,16 @@ type Config struct {
 	UserAgent string
 
 	PeerKey crypto.PrivKey
+	// KeyType is the type of the identity keys generated for this node,
+	// crypto.RSA unless set via the KeyType option function.
+	KeyType int
+	// IdentityFile is the path of the key file the node identifies itself
+	// with, encrypted with IdentityPassphrase unless it is empty. The key is
+	// loaded, or generated of KeyType and saved there, by NewNode.
+	//
+	// Set it via the IdentityFromFile option function.
+	IdentityFile       string
+	IdentityPassphrase string
 
 	Transports         []TptC
 	Muxers             []MsMuxC
@@ -65,12 +82,22 @@ type Config struct {
 	AddrsFactory bhost.AddrsFactory
 	Filters      *filter.Filters
 
-	ConnManager connmgr.ConnManager
-	NATManager  NATManagerC
-	Peerstore   peerstore.Peerstore
-	Reporter    metrics.Reporter
+	ConnManager     connmgr.ConnManager
+	ConnectionGater pconnmgr.ConnectionGater
+	ResourceManager *rcmgr.ResourceManager
+	NATManager      NATManagerC
+	Peerstore       peerstore.Peerstore
+	MaxPeers        int
+	Reporter        metrics.Reporter
+	Metrics         *pmetrics.Registry
+
+	EnablePing bool
+	PingOpts   []ping.Option
 
-	DisablePing bool
+	EnableIdentify bool
+	IdentifyOpts   []identify.Option
+
+	NotifyPeersOnDrain bool
 
 	Routing RoutingC
 
@@ -78,6 +105,9 @@ type Config struct {
 	StaticRelays    []peer.AddrInfo
 }
 
+// GeneratedKeyBits is the size of the RSA identity keys generated for nodes
+const GeneratedKeyBits = 2048
+
 // NewNode constructs a new libp2p Host from the Config.
 //
 // This function consumes the config. Do not reuse it (really!).
@@ -89,6 +119,13 @@ func (cfg *Config) NewNode(ctx context.Context, logger *zap.Logger) (host.Host,
 		return nil, pnet.ErrNotInPrivateNetwork
 	}
 
+	if cfg.PeerKey == nil && cfg.IdentityFile != "" {
+		sk, err := keystore.LoadOrCreateKey(cfg.IdentityFile, cfg.IdentityPassphrase, cfg.KeyType, GeneratedKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load identity from %s: %v", cfg.IdentityFile, err)
+		}
+		cfg.PeerKey = sk
+	}
 	if cfg.PeerKey == nil {
 		return nil, fmt.Errorf("no peer key specified")
 	}
@@ -115,19 +152,49 @@ func (cfg *Config) NewNode(ctx context.Context, logger *zap.Logger) (host.Host,
 	if cfg.Filters != nil {
 		swrm.Filters = cfg.Filters
 	}
+	swrm.Gater = cfg.ConnectionGater
+	swrm.ResourceManager = cfg.ResourceManager
+	if cfg.Metrics != nil {
+		pmetrics.InstrumentSwarm(cfg.Metrics, swrm)
+	}
 
 	h, err := bhost.NewHost(ctx, swrm, &bhost.HostOpts{
-		ConnManager:  cfg.ConnManager,
-		AddrsFactory: cfg.AddrsFactory,
-		NATManager:   cfg.NATManager,
-		EnablePing:   !cfg.DisablePing,
-		UserAgent:    cfg.UserAgent,
+		ConnManager:    cfg.ConnManager,
+		AddrsFactory:   cfg.AddrsFactory,
+		NATManager:     cfg.NATManager,
+		EnablePing:     cfg.EnablePing,
+		PingOpts:       cfg.PingOpts,
+		UserAgent:      cfg.UserAgent,
+		EnableIdentify: cfg.EnableIdentify,
+		IdentifyOpts:   cfg.IdentifyOpts,
+
+		NotifyPeersOnDrain: cfg.NotifyPeersOnDrain,
 	}, logger)
 
 	if err != nil {
 		swrm.Close()
 		return nil, err
 	}
+	if cfg.Metrics != nil {
+		pmetrics.InstrumentHost(cfg.Metrics, h)
+	}
+
+	if cfg.MaxPeers > 0 {
+		bps, ok := cfg.Peerstore.(pstoreimpl.BoundedPeerstore)
+		if !ok {
+			h.Close()
+			return nil, fmt.Errorf("cannot bound the number of peers; peerstore doesn't support eviction")
+		}
+		cm := h.ConnManager()
+		bps.SetEvictionFilter(func(p peer.ID) bool {
+			if swrm.Connectedness(p) == network.Connected {
+				return true
+			}
+			protector, ok := cm.(interface{ IsProtected(peer.ID, string) bool })
+			return ok && protector.IsProtected(p, "")
+		})
+		bps.SetMaxPeers(cfg.MaxPeers)
+	}
 
 	if cfg.Relay {
 		// If we've enabled the relay, we should filter out relay
@@ -143,6 +210,8 @@ func (cfg *Config) NewNode(ctx context.Context, logger *zap.Logger) (host.Host,
 	upgrader := new(tptu.Upgrader)
 	upgrader.Protector = cfg.Protector
 	upgrader.Filters = swrm.Filters
+	upgrader.Gater = swrm.Gater
+	upgrader.Logger = logger.Named("upgrader")
 	if cfg.Insecure {
 		upgrader.Secure = makeInsecureTransport(pid, cfg.PeerKey)
 	} else {
@@ -173,11 +242,14 @@ func (cfg *Config) NewNode(ctx context.Context, logger *zap.Logger) (host.Host,
 	}
 
 	if cfg.Relay {
-		err := circuit.AddRelayTransport(swrm.Context(), h, upgrader, cfg.RelayOpts...)
+		r, err := circuit.AddRelayTransport(swrm.Context(), h, upgrader, cfg.RelayOpts...)
 		if err != nil {
 			h.Close()
 			return nil, err
 		}
+		if cfg.Metrics != nil {
+			pmetrics.InstrumentRelay(cfg.Metrics, r)
+		}
 	}
 
 	// TODO: This method succeeds if listening on one address succeeds. We
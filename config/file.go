@@ -0,0 +1,231 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is the encoding of a node configuration file
+type Format int
+
+const (
+	// FormatYAML encodes node configurations as YAML
+	FormatYAML Format = iota
+	// FormatJSON encodes node configurations as JSON
+	FormatJSON
+)
+
+// FormatOf returns the format of the node configuration file at path, based on
+// its extension. Files not ending in .json are assumed to be YAML.
+func FormatOf(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// NodeConfig is the declarative configuration of a node, as loaded from a
+// YAML or JSON file. Transports, security transports and muxers are referred
+// to by the names they are registered under, see RegisterTransport,
+// RegisterSecurity and RegisterMuxer. Omitted fields fall back to the
+// libp2p defaults.
+type NodeConfig struct {
+	ListenAddrs []string     `yaml:"listen_addrs,omitempty" json:"listen_addrs,omitempty"`
+	Transports  []string     `yaml:"transports,omitempty" json:"transports,omitempty"`
+	Security    []string     `yaml:"security,omitempty" json:"security,omitempty"`
+	Insecure    bool         `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	Muxers      []string     `yaml:"muxers,omitempty" json:"muxers,omitempty"`
+	Relay       *RelayConfig `yaml:"relay,omitempty" json:"relay,omitempty"`
+	NAT         *NATConfig   `yaml:"nat,omitempty" json:"nat,omitempty"`
+	// Filters are the CIDR masks of the addresses never to dial nor accept
+	// connections from
+	Filters   []string `yaml:"filters,omitempty" json:"filters,omitempty"`
+	UserAgent string   `yaml:"user_agent,omitempty" json:"user_agent,omitempty"`
+	MaxPeers  int      `yaml:"max_peers,omitempty" json:"max_peers,omitempty"`
+}
+
+// RelayConfig configures the relay transport
+type RelayConfig struct {
+	// Enabled defaults to true
+	Enabled   *bool `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+	Active    bool  `yaml:"active,omitempty" json:"active,omitempty"`
+	Hop       bool  `yaml:"hop,omitempty" json:"hop,omitempty"`
+	Discovery bool  `yaml:"discovery,omitempty" json:"discovery,omitempty"`
+	AutoRelay bool  `yaml:"auto_relay,omitempty" json:"auto_relay,omitempty"`
+	// StaticRelays are the /p2p multiaddrs of the relays used by autorelay
+	StaticRelays []string `yaml:"static_relays,omitempty" json:"static_relays,omitempty"`
+}
+
+// NATConfig configures NAT traversal
+type NATConfig struct {
+	PortMap bool `yaml:"port_map,omitempty" json:"port_map,omitempty"`
+}
+
+// LoadNodeConfig reads and validates the node configuration file at path
+func LoadNodeConfig(path string) (*NodeConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	nc, err := ParseNodeConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return nc, nil
+}
+
+// ParseNodeConfig decodes and validates a YAML or JSON node configuration.
+// Unknown keys are rejected.
+func ParseNodeConfig(data []byte) (*NodeConfig, error) {
+	var nc NodeConfig
+	// JSON being a subset of YAML, a single strict decoder handles both
+	if err := yaml.UnmarshalStrict(data, &nc); err != nil {
+		return nil, fmt.Errorf("invalid node configuration: %v", err)
+	}
+	if err := nc.Validate(); err != nil {
+		return nil, err
+	}
+	return &nc, nil
+}
+
+// Validate checks that every address, mask and name of the configuration
+// can be resolved
+func (nc *NodeConfig) Validate() error {
+	for _, s := range nc.ListenAddrs {
+		if _, err := ma.NewMultiaddr(s); err != nil {
+			return fmt.Errorf("invalid listen address %q: %v", s, err)
+		}
+	}
+	if err := checkNames("transport", nc.Transports, func(name string) error {
+		_, err := LookupTransport(name)
+		return err
+	}); err != nil {
+		return err
+	}
+	if err := checkNames("security transport", nc.Security, func(name string) error {
+		_, err := LookupSecurity(name)
+		return err
+	}); err != nil {
+		return err
+	}
+	if nc.Insecure && len(nc.Security) > 0 {
+		return fmt.Errorf("security transports cannot be configured on an insecure node")
+	}
+	if err := checkNames("muxer", nc.Muxers, func(name string) error {
+		_, err := LookupMuxer(name)
+		return err
+	}); err != nil {
+		return err
+	}
+	for _, s := range nc.Filters {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			return fmt.Errorf("invalid filter %q: %v", s, err)
+		}
+	}
+	if nc.MaxPeers < 0 {
+		return fmt.Errorf("max_peers must not be negative")
+	}
+	if r := nc.Relay; r != nil {
+		if r.Enabled != nil && !*r.Enabled && (r.Active || r.Hop || r.Discovery || r.AutoRelay) {
+			return fmt.Errorf("relay options cannot be set with the relay disabled")
+		}
+		for _, s := range r.StaticRelays {
+			if _, err := ParseStaticRelay(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ParseStaticRelay parses the /p2p multiaddr of a static relay
+func ParseStaticRelay(s string) (*peer.AddrInfo, error) {
+	addr, err := ma.NewMultiaddr(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static relay %q: %v", s, err)
+	}
+	pi, err := peer.AddrInfoFromP2pAddr(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid static relay %q: %v", s, err)
+	}
+	return pi, nil
+}
+
+// checkNames resolves every name with lookup, rejecting duplicates
+func checkNames(kind string, names []string, lookup func(string) error) error {
+	seen := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("duplicate %s %q", kind, name)
+		}
+		seen[name] = struct{}{}
+		if err := lookup(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve returns a copy of the configuration with the omitted fields set to
+// the values the libp2p defaults would give them
+func (nc *NodeConfig) Resolve() *NodeConfig {
+	res := *nc
+	if len(res.Transports) == 0 && len(res.ListenAddrs) == 0 {
+		res.ListenAddrs = append([]string(nil), DefaultListenAddrs...)
+	}
+	if len(res.Transports) == 0 {
+		res.Transports = append([]string(nil), DefaultTransportNames...)
+	}
+	if len(res.Muxers) == 0 {
+		res.Muxers = append([]string(nil), DefaultMuxerNames...)
+	}
+	if len(res.Security) == 0 && !res.Insecure {
+		res.Security = append([]string(nil), DefaultSecurityNames...)
+	}
+	relay := RelayConfig{}
+	if res.Relay != nil {
+		relay = *res.Relay
+	}
+	if relay.Enabled == nil {
+		enabled := true
+		relay.Enabled = &enabled
+	}
+	res.Relay = &relay
+	if res.NAT == nil {
+		res.NAT = &NATConfig{}
+	}
+	return &res
+}
+
+// DumpNodeConfig writes the effective configuration of nc, that is with the
+// omitted fields resolved to their defaults, to w
+func DumpNodeConfig(w io.Writer, nc *NodeConfig, format Format) error {
+	res := nc.Resolve()
+	var (
+		data []byte
+		err  error
+	)
+	switch format {
+	case FormatJSON:
+		data, err = json.MarshalIndent(res, "", "  ")
+		data = append(data, '\n')
+	case FormatYAML:
+		data, err = yaml.Marshal(res)
+	default:
+		return fmt.Errorf("unknown node configuration format %d", format)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseNodeConfig(t *testing.T) {
+	nc, err := ParseNodeConfig([]byte(`
+listen_addrs: [/ip4/127.0.0.1/tcp/0]
+transports: [tcp]
+muxers: [mplex]
+relay:
+  enabled: false
+filters: [10.0.0.0/8]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nc.Transports) != 1 || nc.Transports[0] != "tcp" {
+		t.Fatalf("unexpected transports %v", nc.Transports)
+	}
+	if nc.Relay == nil || nc.Relay.Enabled == nil || *nc.Relay.Enabled {
+		t.Fatal("relay should be disabled")
+	}
+
+	// JSON is accepted as well
+	if _, err := ParseNodeConfig([]byte(`{"transports": ["ws"], "nat": {"port_map": true}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		conf string
+		err  string
+	}{
+		{"listen_addr: [/ip4/127.0.0.1/tcp/0]", "field listen_addr not found"},
+		{"relay: {hops: true}", "field hops not found"},
+		{"transports: [carrier-pigeon]", `unknown transport "carrier-pigeon"`},
+		{"muxers: [yamux, yamux]", `duplicate muxer "yamux"`},
+		{"security: [secio]\ninsecure: true", "insecure"},
+		{"filters: [10.0.0.0]", "invalid filter"},
+		{"relay: {static_relays: [/ip4/1.2.3.4/tcp/1]}", "invalid static relay"},
+	} {
+		if _, err := ParseNodeConfig([]byte(tc.conf)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%q: expected error containing %q, got %v", tc.conf, tc.err, err)
+		}
+	}
+}
+
+func TestDumpNodeConfig(t *testing.T) {
+	nc, err := ParseNodeConfig([]byte("muxers: [mplex]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		var buf bytes.Buffer
+		if err := DumpNodeConfig(&buf, nc, format); err != nil {
+			t.Fatal(err)
+		}
+		dumped, err := ParseNodeConfig(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(dumped.Transports, ",") != "tcp,ws" {
+			t.Fatalf("default transports were not resolved: %v", dumped.Transports)
+		}
+		if strings.Join(dumped.Muxers, ",") != "mplex" {
+			t.Fatalf("configured muxers were not kept: %v", dumped.Muxers)
+		}
+		if dumped.Relay == nil || dumped.Relay.Enabled == nil || !*dumped.Relay.Enabled {
+			t.Fatal("relay should be enabled by default")
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	mplex "github.com/RTradeLtd/libp2px/pkg/transports/mplex"
+	secio "github.com/RTradeLtd/libp2px/pkg/transports/secio"
+	tcp "github.com/RTradeLtd/libp2px/pkg/transports/tcp"
+	tls "github.com/RTradeLtd/libp2px/pkg/transports/tls"
+	ws "github.com/RTradeLtd/libp2px/pkg/transports/ws"
+	yamux "github.com/RTradeLtd/libp2px/pkg/transports/yamux"
+)
+
+// Protocol is a security transport or stream multiplexer registered by name,
+// along with the protocol ID it is negotiated under
+type Protocol struct {
+	ID          string
+	Constructor interface{}
+}
+
+// the transports, security transports and muxers a NodeConfig can refer to
+var registry = struct {
+	sync.RWMutex
+	transports map[string]interface{}
+	security   map[string]Protocol
+	muxers     map[string]Protocol
+}{
+	transports: map[string]interface{}{
+		"tcp": tcp.NewTCPTransport,
+		"ws":  ws.New,
+	},
+	security: map[string]Protocol{
+		"secio": {ID: secio.ID, Constructor: secio.New},
+		"tls":   {ID: tls.ID, Constructor: tls.New},
+	},
+	muxers: map[string]Protocol{
+		"yamux": {ID: "/yamux/1.0.0", Constructor: yamux.DefaultTransport},
+		"mplex": {ID: "/mplex/6.7.0", Constructor: mplex.DefaultTransport},
+	},
+}
+
+// The transports, security transports, muxers and listen addresses a node
+// uses unless configured otherwise, the former referring to the registry by
+// name. Both the libp2p defaults and NodeConfig.Resolve derive from these.
+var (
+	DefaultTransportNames = []string{"tcp", "ws"}
+	DefaultSecurityNames  = []string{"secio"}
+	DefaultMuxerNames     = []string{"yamux", "mplex"}
+	DefaultListenAddrs    = []string{"/ip4/0.0.0.0/tcp/0", "/ip6/::/tcp/0"}
+)
+
+// RegisterTransport makes the transport constructor tpt available to node
+// configuration files under name. See TransportConstructor for the accepted
+// constructors.
+func RegisterTransport(name string, tpt interface{}) error {
+	if _, err := TransportConstructor(tpt); err != nil {
+		return err
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.transports[name]; ok {
+		return fmt.Errorf("transport %q is already registered", name)
+	}
+	registry.transports[name] = tpt
+	return nil
+}
+
+// RegisterSecurity makes the security transport constructor sec, negotiated
+// under id, available to node configuration files under name. See
+// SecurityConstructor for the accepted constructors.
+func RegisterSecurity(name, id string, sec interface{}) error {
+	if _, err := SecurityConstructor(sec); err != nil {
+		return err
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.security[name]; ok {
+		return fmt.Errorf("security transport %q is already registered", name)
+	}
+	registry.security[name] = Protocol{ID: id, Constructor: sec}
+	return nil
+}
+
+// RegisterMuxer makes the stream multiplexer constructor mux, negotiated
+// under id, available to node configuration files under name. See
+// MuxerConstructor for the accepted constructors.
+func RegisterMuxer(name, id string, mux interface{}) error {
+	if _, err := MuxerConstructor(mux); err != nil {
+		return err
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.muxers[name]; ok {
+		return fmt.Errorf("muxer %q is already registered", name)
+	}
+	registry.muxers[name] = Protocol{ID: id, Constructor: mux}
+	return nil
+}
+
+// LookupTransport returns the transport constructor registered under name
+func LookupTransport(name string) (interface{}, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	tpt, ok := registry.transports[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown transport %q (registered: %s)", name, registeredNames(registry.transports))
+	}
+	return tpt, nil
+}
+
+// LookupSecurity returns the security transport registered under name
+func LookupSecurity(name string) (Protocol, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	sec, ok := registry.security[name]
+	if !ok {
+		return Protocol{}, fmt.Errorf("unknown security transport %q (registered: %s)", name, registeredNames(registry.security))
+	}
+	return sec, nil
+}
+
+// LookupMuxer returns the stream multiplexer registered under name
+func LookupMuxer(name string) (Protocol, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	mux, ok := registry.muxers[name]
+	if !ok {
+		return Protocol{}, fmt.Errorf("unknown muxer %q (registered: %s)", name, registeredNames(registry.muxers))
+	}
+	return mux, nil
+}
+
+// registeredNames returns the sorted keys of one of the registry maps
+func registeredNames(m interface{}) string {
+	var names []string
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for name := range m {
+			names = append(names, name)
+		}
+	case map[string]Protocol:
+		for name := range m {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,161 @@
+package libp2p
+
+import (
+	"net"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	config "github.com/RTradeLtd/libp2px/config"
+	circuit "github.com/RTradeLtd/libp2px/pkg/transports/circuit"
+)
+
+// LoadConfig reads the YAML or JSON node configuration file at path and
+// returns the options it describes. The options can be combined with others
+// given in code, such as Identity or Routing.
+//
+// Use config.DumpNodeConfig to print the effective configuration.
+func LoadConfig(path string) ([]Option, error) {
+	nc, err := config.LoadNodeConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	return NodeConfigOptions(nc)
+}
+
+// NodeConfigOptions returns the options described by a node configuration.
+// Omitted fields are left to the defaults.
+func NodeConfigOptions(nc *config.NodeConfig) ([]Option, error) {
+	if err := nc.Validate(); err != nil {
+		return nil, err
+	}
+
+	var opts []Option
+	if len(nc.ListenAddrs) > 0 {
+		opts = append(opts, ListenAddrStrings(nc.ListenAddrs...))
+	}
+	tpts, err := transportOptions(nc.Transports)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, tpts...)
+	secs, err := securityOptions(nc.Security)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, secs...)
+	if nc.Insecure {
+		opts = append(opts, NoSecurity)
+	}
+	muxers, err := muxerOptions(nc.Muxers)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, muxers...)
+
+	if r := nc.Relay; r != nil {
+		if r.Enabled != nil && !*r.Enabled {
+			opts = append(opts, DisableRelay())
+		} else {
+			var relayOpts []circuit.Opt
+			if r.Active {
+				relayOpts = append(relayOpts, circuit.OptActive)
+			}
+			if r.Hop {
+				relayOpts = append(relayOpts, circuit.OptHop)
+			}
+			if r.Discovery {
+				relayOpts = append(relayOpts, circuit.OptDiscovery)
+			}
+			opts = append(opts, EnableRelay(relayOpts...))
+		}
+		if r.AutoRelay {
+			opts = append(opts, EnableAutoRelay())
+		}
+		if len(r.StaticRelays) > 0 {
+			relays := make([]peer.AddrInfo, 0, len(r.StaticRelays))
+			for _, s := range r.StaticRelays {
+				pi, err := config.ParseStaticRelay(s)
+				if err != nil {
+					return nil, err
+				}
+				relays = append(relays, *pi)
+			}
+			opts = append(opts, StaticRelays(relays))
+		}
+	}
+	if nc.NAT != nil && nc.NAT.PortMap {
+		opts = append(opts, NATPortMap())
+	}
+
+	if len(nc.Filters) > 0 {
+		masks := make([]*net.IPNet, 0, len(nc.Filters))
+		for _, s := range nc.Filters {
+			_, mask, err := net.ParseCIDR(s)
+			if err != nil {
+				return nil, err
+			}
+			masks = append(masks, mask)
+		}
+		opts = append(opts, FilterAddresses(masks...))
+	}
+	if nc.UserAgent != "" {
+		opts = append(opts, UserAgent(nc.UserAgent))
+	}
+	if nc.MaxPeers > 0 {
+		opts = append(opts, MaxPeers(nc.MaxPeers))
+	}
+	return opts, nil
+}
+
+// transportOptions returns the options adding the transports registered
+// under names
+func transportOptions(names []string) ([]Option, error) {
+	opts := make([]Option, 0, len(names))
+	for _, name := range names {
+		tpt, err := config.LookupTransport(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, Transport(tpt))
+	}
+	return opts, nil
+}
+
+// securityOptions returns the options adding the security transports
+// registered under names
+func securityOptions(names []string) ([]Option, error) {
+	opts := make([]Option, 0, len(names))
+	for _, name := range names {
+		sec, err := config.LookupSecurity(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, Security(sec.ID, sec.Constructor))
+	}
+	return opts, nil
+}
+
+// muxerOptions returns the options adding the stream multiplexers
+// registered under names
+func muxerOptions(names []string) ([]Option, error) {
+	opts := make([]Option, 0, len(names))
+	for _, name := range names {
+		mux, err := config.LookupMuxer(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, Muxer(mux.ID, mux.Constructor))
+	}
+	return opts, nil
+}
+
+// registeredOptions returns an option applying the options build returns
+// for names, resolved when the option is applied
+func registeredOptions(build func([]string) ([]Option, error), names []string) Option {
+	return func(cfg *Config) error {
+		opts, err := build(names)
+		if err != nil {
+			return err
+		}
+		return cfg.Apply(opts...)
+	}
+}
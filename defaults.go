@@ -7,47 +7,37 @@ import (
 	"crypto/rand"
 
 	crypto "github.com/RTradeLtd/libp2px-core/crypto"
+	config "github.com/RTradeLtd/libp2px/config"
 	pstoremem "github.com/RTradeLtd/libp2px/pkg/peerstore/pstoremem"
-	mplex "github.com/RTradeLtd/libp2px/pkg/transports/mplex"
-	secio "github.com/RTradeLtd/libp2px/pkg/transports/secio"
-	tcp "github.com/RTradeLtd/libp2px/pkg/transports/tcp"
-	ws "github.com/RTradeLtd/libp2px/pkg/transports/ws"
-	yamux "github.com/RTradeLtd/libp2px/pkg/transports/yamux"
-	multiaddr "github.com/multiformats/go-multiaddr"
 )
 
 // DefaultSecurity is the default security option.
 //
 // Useful when you want to extend, but not replace, the supported transport
 // security protocols.
-var DefaultSecurity = Security(secio.ID, secio.New)
+var DefaultSecurity = registeredOptions(securityOptions, config.DefaultSecurityNames)
 
 // DefaultMuxers configures libp2p to use the stream connection multiplexers.
 //
 // Use this option when you want to *extend* the set of multiplexers used by
 // libp2p instead of replacing them.
-var DefaultMuxers = ChainOptions(
-	Muxer("/yamux/1.0.0", yamux.DefaultTransport),
-	Muxer("/mplex/6.7.0", mplex.DefaultTransport),
-)
+var DefaultMuxers = registeredOptions(muxerOptions, config.DefaultMuxerNames)
 
 // DefaultTransports are the default libp2p transports.
 //
 // Use this option when you want to *extend* the set of transports used by
 // libp2p instead of replacing them.
-var DefaultTransports = ChainOptions(
-	Transport(tcp.NewTCPTransport),
-	Transport(ws.New),
-)
+var DefaultTransports = registeredOptions(transportOptions, config.DefaultTransportNames)
 
 // DefaultPeerstore configures libp2p to use the default peerstore.
 var DefaultPeerstore Option = func(cfg *Config) error {
 	return cfg.Apply(Peerstore(pstoremem.NewPeerstore(context.Background())))
 }
 
-// RandomIdentity generates a random identity (default behaviour)
+// RandomIdentity generates a random identity (default behaviour), of the type
+// set with the KeyType option
 var RandomIdentity = func(cfg *Config) error {
-	priv, _, err := crypto.GenerateKeyPairWithReader(crypto.RSA, 2048, rand.Reader)
+	priv, _, err := crypto.GenerateKeyPairWithReader(cfg.KeyType, config.GeneratedKeyBits, rand.Reader)
 	if err != nil {
 		return err
 	}
@@ -56,19 +46,7 @@ var RandomIdentity = func(cfg *Config) error {
 
 // DefaultListenAddrs configures libp2p to use default listen address
 var DefaultListenAddrs = func(cfg *Config) error {
-	defaultIP4ListenAddr, err := multiaddr.NewMultiaddr("/ip4/0.0.0.0/tcp/0")
-	if err != nil {
-		return err
-	}
-
-	defaultIP6ListenAddr, err := multiaddr.NewMultiaddr("/ip6/::/tcp/0")
-	if err != nil {
-		return err
-	}
-	return cfg.Apply(ListenAddrs(
-		defaultIP4ListenAddr,
-		defaultIP6ListenAddr,
-	))
+	return cfg.Apply(ListenAddrStrings(config.DefaultListenAddrs...))
 }
 
 // DefaultEnableRelay enables relay dialing and listening by default
@@ -101,7 +79,7 @@ var defaults = []struct {
 		opt:      DefaultSecurity,
 	},
 	{
-		fallback: func(cfg *Config) bool { return cfg.PeerKey == nil },
+		fallback: func(cfg *Config) bool { return cfg.PeerKey == nil && cfg.IdentityFile == "" },
 		opt:      RandomIdentity,
 	},
 	{
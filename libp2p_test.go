@@ -2,15 +2,31 @@ package libp2p
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/RTradeLtd/libp2px-core/crypto"
 	"github.com/RTradeLtd/libp2px-core/host"
+	"github.com/RTradeLtd/libp2px-core/network"
 	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/test"
+	"github.com/RTradeLtd/libp2px-core/transport"
+	"github.com/RTradeLtd/libp2px/pkg/connmgr"
+	"github.com/RTradeLtd/libp2px/pkg/metrics"
+	pstore "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	"github.com/RTradeLtd/libp2px/pkg/ping"
+	"github.com/RTradeLtd/libp2px/pkg/rcmgr"
+	"github.com/RTradeLtd/libp2px/pkg/swarm"
 	"github.com/RTradeLtd/libp2px/pkg/transports/tcp"
+	ma "github.com/multiformats/go-multiaddr"
 	"go.uber.org/zap/zaptest"
 )
 
@@ -22,6 +38,36 @@ func TestNewHost(t *testing.T) {
 	h.Close()
 }
 
+func TestPingOptIn(t *testing.T) {
+	ctx := context.Background()
+	supportsPing := func(h host.Host) bool {
+		for _, p := range h.Mux().Protocols() {
+			if p == ping.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	h, err := New(ctx, zaptest.NewLogger(t), NoListenAddrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	if supportsPing(h) {
+		t.Fatal("ping should be disabled by default")
+	}
+
+	h2, err := New(ctx, zaptest.NewLogger(t), NoListenAddrs, Ping(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	if !supportsPing(h2) {
+		t.Fatal("ping should have been enabled")
+	}
+}
+
 func TestBadTransportConstructor(t *testing.T) {
 	ctx := context.Background()
 	h, err := New(ctx, zaptest.NewLogger(t), Transport(func() {}))
@@ -163,3 +209,317 @@ func TestChainOptions(t *testing.T) {
 		}
 	}
 }
+
+var errRefused = errors.New("refused by test gater")
+
+// testGater refuses connections at a single point
+type testGater struct {
+	point connmgr.GatePoint
+}
+
+func (g *testGater) refuse(point connmgr.GatePoint) error {
+	if g.point == point {
+		return errRefused
+	}
+	return nil
+}
+
+func (g *testGater) InterceptPeerDial(peer.ID) error {
+	return g.refuse(connmgr.GatePeerDial)
+}
+
+func (g *testGater) InterceptAddrDial(peer.ID, ma.Multiaddr) error {
+	return g.refuse(connmgr.GateAddrDial)
+}
+
+func (g *testGater) InterceptAccept(network.ConnMultiaddrs) error {
+	return g.refuse(connmgr.GateAccept)
+}
+
+func (g *testGater) InterceptSecured(network.Direction, peer.ID, network.ConnMultiaddrs) error {
+	return g.refuse(connmgr.GateSecured)
+}
+
+func (g *testGater) InterceptUpgraded(transport.CapableConn) error {
+	return g.refuse(connmgr.GateUpgraded)
+}
+
+// findGateError returns the gate error causing the dial error, or any of its
+// per address errors
+func findGateError(err error) *connmgr.GateError {
+	var gateErr *connmgr.GateError
+	if errors.As(err, &gateErr) {
+		return gateErr
+	}
+	var dialErr *swarm.DialError
+	if errors.As(err, &dialErr) {
+		for _, te := range dialErr.DialErrors {
+			if errors.As(te.Cause, &gateErr) {
+				return gateErr
+			}
+		}
+	}
+	return nil
+}
+
+func TestConnectionGater(t *testing.T) {
+	ctx := context.Background()
+	for _, point := range []connmgr.GatePoint{
+		connmgr.GatePeerDial,
+		connmgr.GateAddrDial,
+		connmgr.GateSecured,
+		connmgr.GateUpgraded,
+	} {
+		a, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), ConnectionGater(&testGater{point: point}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()})
+		if gateErr := findGateError(err); gateErr == nil {
+			t.Errorf("%s: expected a gate error, got %v", point, err)
+		} else if gateErr.Point != point || gateErr.Reason != errRefused {
+			t.Errorf("%s: unexpected gate error %v", point, gateErr)
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestConnectionGaterAccept(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), ConnectionGater(&testGater{point: connmgr.GateAccept}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}); err == nil {
+		t.Fatal("expected the inbound connection to be refused")
+	}
+	if len(b.Network().Peers()) != 0 {
+		t.Fatal("refused peer was added to the swarm")
+	}
+}
+
+func TestResourceManager(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), ResourceManager(rcmgr.NewResourceManager(rcmgr.LimitConfig{
+		PeerDefault: rcmgr.Limit{StreamsOutbound: 2},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), ResourceManager(rcmgr.NewResourceManager(rcmgr.LimitConfig{
+		ProtocolDefault: rcmgr.Limit{StreamsInbound: 1},
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.SetStreamHandler("/echo", func(s network.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+
+	if err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	echo := func(s network.Stream) error {
+		if _, err := s.Write([]byte("ping")); err != nil {
+			return err
+		}
+		_, err := io.ReadFull(s, make([]byte, 4))
+		return err
+	}
+
+	s1, err := a.NewStream(ctx, b.ID(), "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo(s1); err != nil {
+		t.Fatal(err)
+	}
+
+	// b only accepts a single inbound /echo stream
+	s2, err := a.NewStream(ctx, b.ID(), "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := echo(s2); err == nil {
+		t.Fatal("expected the stream to be reset by the remote")
+	}
+
+	// a only opens two outbound streams to b
+	if _, err := a.NewStream(ctx, b.ID(), "/echo"); !errors.Is(err, rcmgr.ErrResourceLimitExceeded) {
+		t.Fatalf("expected the outbound stream limit to be hit, got %v", err)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	reg := metrics.NewRegistry()
+	a, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), Metrics(reg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	b.SetStreamHandler("/echo", func(s network.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+
+	if err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := a.NewStream(ctx, b.ID(), "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		`libp2px_swarm_dials_total{transport="tcp",outcome="success"} 1`,
+		`libp2px_swarm_connections{transport="tcp",direction="outbound"} 1`,
+		`libp2px_swarm_streams{protocol="/echo",direction="outbound"} 1`,
+		`libp2px_host_streams_total{protocol="/echo",direction="outbound"} 1`,
+		`libp2px_swarm_dial_limiter_fd_in_use 0`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("missing %s in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestMaxPeers(t *testing.T) {
+	ctx := context.Background()
+	a, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"), MaxPeers(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := New(ctx, zaptest.NewLogger(t), ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if err := a.Connect(ctx, peer.AddrInfo{ID: b.ID(), Addrs: b.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	for i := 0; i < 10; i++ {
+		p, err := test.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.Peerstore().AddAddr(p, addr, time.Hour)
+	}
+
+	// the local and connected peers are kept
+	if len(a.Peerstore().Peers()) > 3 {
+		t.Fatalf("expected at most 3 peers, got %d", len(a.Peerstore().Peers()))
+	}
+	if len(a.Peerstore().Addrs(b.ID())) == 0 {
+		t.Fatal("connected peer was evicted")
+	}
+	if ps := a.Peerstore().(pstore.BoundedPeerstore); ps.Evictions() != 9 {
+		t.Fatalf("expected 9 evictions, got %d", ps.Evictions())
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libp2p-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "node.yaml")
+	conf := "listen_addrs: [/ip4/127.0.0.1/tcp/0]\ntransports: [tcp]\nrelay: {enabled: false}\nuser_agent: test/1.0\n"
+	if err := ioutil.WriteFile(path, []byte(conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := New(context.Background(), zaptest.NewLogger(t), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	addrs := h.Network().ListenAddresses()
+	if len(addrs) != 1 || !strings.HasPrefix(addrs[0].String(), "/ip4/127.0.0.1/tcp/") {
+		t.Fatalf("unexpected listen addresses %v", addrs)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("transport: [tcp]\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("expected unknown keys to be rejected")
+	}
+}
+
+func TestIdentityFromFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "libp2p-identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "identity.key")
+
+	var ids []peer.ID
+	for i := 0; i < 2; i++ {
+		// the key type applies even when set after the identity file
+		h, err := New(context.Background(), zaptest.NewLogger(t), NoListenAddrs, IdentityFromFile(path, "passphrase"), KeyType(crypto.Ed25519))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := h.Peerstore().PrivKey(h.ID()).Type(); typ != crypto.Ed25519 {
+			t.Fatalf("expected an Ed25519 identity, got type %d", typ)
+		}
+		ids = append(ids, h.ID())
+		h.Close()
+	}
+	if ids[0] != ids[1] {
+		t.Fatal("identity changed across restarts")
+	}
+
+	if _, err := New(context.Background(), zaptest.NewLogger(t), NoListenAddrs, IdentityFromFile(path, "wrong")); err == nil {
+		t.Fatal("expected the wrong passphrase to be rejected")
+	}
+	sk, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(context.Background(), zaptest.NewLogger(t), NoListenAddrs, IdentityFromFile(path, "passphrase"), Identity(sk)); err == nil {
+		t.Fatal("expected multiple identities to be rejected")
+	}
+}
@@ -6,6 +6,7 @@ package libp2p
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"github.com/RTradeLtd/libp2px-core/connmgr"
 	"github.com/RTradeLtd/libp2px-core/crypto"
@@ -17,6 +18,11 @@ import (
 	config "github.com/RTradeLtd/libp2px/config"
 	bhost "github.com/RTradeLtd/libp2px/p2p/host/basic"
 	autorelay "github.com/RTradeLtd/libp2px/p2p/host/relay"
+	pconnmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
+	identify "github.com/RTradeLtd/libp2px/pkg/identify"
+	pmetrics "github.com/RTradeLtd/libp2px/pkg/metrics"
+	ping "github.com/RTradeLtd/libp2px/pkg/ping"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 	circuit "github.com/RTradeLtd/libp2px/pkg/transports/circuit"
 	filter "github.com/RTradeLtd/libp2px/pkg/utils/filter"
 	ma "github.com/multiformats/go-multiaddr"
@@ -145,6 +151,21 @@ func Peerstore(ps peerstore.Peerstore) Option {
 	}
 }
 
+// MaxPeers configures libp2p to bound the number of peers tracked by the
+// peerstore. Once the bound is exceeded, the least recently updated peers
+// are evicted, except for the connected and protected ones.
+//
+// The peerstore must be one of the peerstores of the peerstore package.
+func MaxPeers(max int) Option {
+	return func(cfg *Config) error {
+		if max <= 0 {
+			return fmt.Errorf("max peers must be positive")
+		}
+		cfg.MaxPeers = max
+		return nil
+	}
+}
+
 // PrivateNetwork configures libp2p to use the given private network protector.
 func PrivateNetwork(prot pnet.Protector) Option {
 	return func(cfg *Config) error {
@@ -169,10 +190,25 @@ func BandwidthReporter(rep metrics.Reporter) Option {
 	}
 }
 
+// Metrics instruments the swarm, host, NAT manager and relay of the node,
+// exporting their metrics through reg. Serve them with reg.Handler, and
+// pass metrics.NewPubSubTracer(reg) to pubsub.WithEventTracer to include
+// pubsub metrics.
+func Metrics(reg *pmetrics.Registry) Option {
+	return func(cfg *Config) error {
+		if cfg.Metrics != nil {
+			return fmt.Errorf("cannot specify multiple metrics registries")
+		}
+
+		cfg.Metrics = reg
+		return nil
+	}
+}
+
 // Identity configures libp2p to use the given private key to identify itself.
 func Identity(sk crypto.PrivKey) Option {
 	return func(cfg *Config) error {
-		if cfg.PeerKey != nil {
+		if cfg.PeerKey != nil || cfg.IdentityFile != "" {
 			return fmt.Errorf("cannot specify multiple identities")
 		}
 
@@ -181,6 +217,37 @@ func Identity(sk crypto.PrivKey) Option {
 	}
 }
 
+// IdentityFromFile configures libp2p to identify itself with the private key
+// stored at path, encrypted with passphrase unless it is empty. On first run,
+// a key is generated and saved there, of the type set with the KeyType
+// option. The key is loaded once all the options are applied.
+func IdentityFromFile(path string, passphrase string) Option {
+	return func(cfg *Config) error {
+		if cfg.PeerKey != nil || cfg.IdentityFile != "" {
+			return fmt.Errorf("cannot specify multiple identities")
+		}
+		cfg.IdentityFile = path
+		cfg.IdentityPassphrase = passphrase
+		return nil
+	}
+}
+
+// KeyType configures the type of the identity keys libp2p generates when no
+// identity is given, or when IdentityFromFile runs for the first time. It
+// defaults to crypto.RSA; crypto.Ed25519 keys are smaller and much faster to
+// generate.
+func KeyType(typ int) Option {
+	return func(cfg *Config) error {
+		switch typ {
+		case crypto.RSA, crypto.Ed25519, crypto.Secp256k1, crypto.ECDSA:
+		default:
+			return fmt.Errorf("unsupported key type %d", typ)
+		}
+		cfg.KeyType = typ
+		return nil
+	}
+}
+
 // ConnectionManager configures libp2p to use the given connection manager.
 func ConnectionManager(connman connmgr.ConnManager) Option {
 	return func(cfg *Config) error {
@@ -192,6 +259,33 @@ func ConnectionManager(connman connmgr.ConnManager) Option {
 	}
 }
 
+// ConnectionGater configures libp2p to consult the given gater before dialing
+// peers and addresses, when accepting connections, once the remote peer is
+// authenticated and once the connection is fully upgraded.
+func ConnectionGater(cg pconnmgr.ConnectionGater) Option {
+	return func(cfg *Config) error {
+		if cfg.ConnectionGater != nil {
+			return fmt.Errorf("cannot specify multiple connection gaters")
+		}
+		cfg.ConnectionGater = cg
+		return nil
+	}
+}
+
+// ResourceManager configures libp2p to limit the connections, streams and
+// memory held by the node using the given resource manager. Streams and
+// connections exceeding a limit are reset, with an error wrapping
+// rcmgr.ErrResourceLimitExceeded.
+func ResourceManager(rm *rcmgr.ResourceManager) Option {
+	return func(cfg *Config) error {
+		if cfg.ResourceManager != nil {
+			return fmt.Errorf("cannot specify multiple resource managers")
+		}
+		cfg.ResourceManager = rm
+		return nil
+	}
+}
+
 // AddrsFactory configures libp2p to use the given address factory.
 func AddrsFactory(factory config.AddrsFactory) Option {
 	return func(cfg *Config) error {
@@ -319,10 +413,37 @@ func NATManager(nm config.NATManagerC) Option {
 	}
 }
 
-// Ping will configure libp2p to support the ping service; enable by default.
+// Ping will configure libp2p to support the ping service (disabled by
+// default). When enabled, we answer the pings of other peers.
 func Ping(enable bool) Option {
 	return func(cfg *Config) error {
-		cfg.DisablePing = !enable
+		cfg.EnablePing = enable
+		return nil
+	}
+}
+
+// PingProber enables the ping service along with a background prober that
+// pings every connected peer once per interval, recording the round trip
+// times into the peerstore latency metrics.
+func PingProber(interval time.Duration, opts ...ping.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnablePing = true
+		cfg.PingOpts = append(cfg.PingOpts, ping.WithProber(interval))
+		cfg.PingOpts = append(cfg.PingOpts, opts...)
+		return nil
+	}
+}
+
+// Identify will configure libp2p to run the identify service (disabled by
+// default). The service fills in the peerstore with the protocols, listen
+// addresses and public key of every peer we connect to, and discloses the
+// same information about us. The user agent set with the UserAgent option is
+// used unless overridden, and each disclosed field can be switched off with
+// the identify.Disclose* options.
+func Identify(opts ...identify.Option) Option {
+	return func(cfg *Config) error {
+		cfg.EnableIdentify = true
+		cfg.IdentifyOpts = append(cfg.IdentifyOpts, opts...)
 		return nil
 	}
 }
@@ -369,3 +490,15 @@ func UserAgent(userAgent string) Option {
 		return nil
 	}
 }
+
+// NotifyPeersOnDrain configures libp2p to tell the connected peers the host is
+// going away when it is drained, letting them move their traffic elsewhere
+// before the connections close. Drain the host by asserting it to a
+// basichost.Drainer. The notices of the peers doing the same are emitted as
+// eventbus.EvtPeerGoingAway.
+func NotifyPeersOnDrain() Option {
+	return func(cfg *Config) error {
+		cfg.NotifyPeersOnDrain = true
+		return nil
+	}
+}
@@ -17,7 +17,13 @@ import (
 	"github.com/RTradeLtd/libp2px-core/peerstore"
 	"github.com/RTradeLtd/libp2px-core/protocol"
 
+	middleware "github.com/RTradeLtd/libp2px/p2p/host/middleware"
 	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	identify "github.com/RTradeLtd/libp2px/pkg/identify"
+	pstore "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	ping "github.com/RTradeLtd/libp2px/pkg/ping"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
+	record "github.com/RTradeLtd/libp2px/pkg/record"
 	inat "github.com/RTradeLtd/libp2px/pkg/utils/nat"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -68,21 +74,34 @@ type BasicHost struct {
 	maResolver *madns.Resolver
 	cmgr       connmgr.ConnManager
 	eventbus   event.Bus
+	ids        *identify.IDService
+	pings      *ping.PingService
 
 	AddrsFactory AddrsFactory
 
 	negtimeout time.Duration
 
-	mx        sync.Mutex
-	lastAddrs []ma.Multiaddr
-	emitters  struct {
+	drain         drainState
+	notifyOnDrain bool
+
+	mw middleware.Chain
+
+	mx           sync.Mutex
+	lastAddrs    []ma.Multiaddr
+	signedRecord *record.Envelope
+	// serializes the renewals of signedRecord, so that it never regresses
+	recordMu sync.Mutex
+	emitters struct {
 		evtLocalProtocolsUpdated event.Emitter
+		evtLocalAddressesUpdated event.Emitter
+		evtPeerGoingAway         event.Emitter
 	}
 
 	logger *zap.Logger
 }
 
 var _ host.Host = (*BasicHost)(nil)
+var _ middleware.Host = (*BasicHost)(nil)
 
 // HostOpts holds options that can be passed to NewHost in order to
 // customize construction of the *BasicHost.
@@ -113,8 +132,22 @@ type HostOpts struct {
 	// EnablePing indicates whether to instantiate the ping service
 	EnablePing bool
 
+	// PingOpts are passed to the ping service when it is enabled
+	PingOpts []ping.Option
+
 	// UserAgent sets the user-agent for the host. Defaults to ClientVersion.
 	UserAgent string
+
+	// EnableIdentify indicates whether to instantiate the identify service
+	EnableIdentify bool
+
+	// IdentifyOpts are passed to the identify service when it is enabled
+	IdentifyOpts []identify.Option
+
+	// NotifyPeersOnDrain indicates whether Drain tells the connected peers
+	// the host is going away, and whether the go away notices of other peers
+	// are emitted as EvtPeerGoingAway
+	NotifyPeersOnDrain bool
 }
 
 // NewHost constructs a new *BasicHost and activates it by attaching its stream and connection handlers to the given inet.Network.
@@ -133,6 +166,18 @@ func NewHost(ctx context.Context, net network.Network, opts *HostOpts, logger *z
 	if h.emitters.evtLocalProtocolsUpdated, err = h.eventbus.Emitter(&event.EvtLocalProtocolsUpdated{}); err != nil {
 		return nil, err
 	}
+	if h.emitters.evtLocalAddressesUpdated, err = h.eventbus.Emitter(&eventbus.EvtLocalAddressesUpdated{}); err != nil {
+		return nil, err
+	}
+	if h.emitters.evtPeerGoingAway, err = h.eventbus.Emitter(&eventbus.EvtPeerGoingAway{}); err != nil {
+		return nil, err
+	}
+	// let the swarm emit its connection events on our bus
+	if es, ok := net.(interface{ SetEventBus(event.Bus) error }); ok {
+		if err := es.SetEventBus(h.eventbus); err != nil {
+			return nil, err
+		}
+	}
 
 	if opts.MultistreamMuxer != nil {
 		h.mux = opts.MultistreamMuxer
@@ -164,6 +209,29 @@ func NewHost(ctx context.Context, net network.Network, opts *HostOpts, logger *z
 	net.SetConnHandler(h.newConnHandler)
 	net.SetStreamHandler(h.newStreamHandler)
 
+	h.notifyOnDrain = opts.NotifyPeersOnDrain
+	if h.notifyOnDrain {
+		h.SetStreamHandler(GoAwayProtocol, h.handleGoAway)
+	}
+
+	if opts.EnablePing {
+		h.pings, err = ping.NewPingService(ctx, h, logger, opts.PingOpts...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.EnableIdentify {
+		var idOpts []identify.Option
+		if opts.UserAgent != "" {
+			idOpts = append(idOpts, identify.UserAgent(opts.UserAgent))
+		}
+		h.ids, err = identify.NewIDService(ctx, h, logger, append(idOpts, opts.IdentifyOpts...)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return h, nil
 }
 
@@ -206,6 +274,12 @@ func New(ctx context.Context, net network.Network, logger *zap.Logger, opts ...i
 
 // newConnHandler is the remote-opened conn handler for inet.Network
 func (h *BasicHost) newConnHandler(c network.Conn) {
+	// identify replaces the known protocols of the peer, so there is
+	// no need to clear them first
+	if h.ids != nil {
+		h.ids.IdentifyConn(c)
+		return
+	}
 	// Clear protocols on connecting to new peer to avoid issues caused
 	// by misremembering protocols between reconnects
 	h.Peerstore().SetProtocols(c.RemotePeer())
@@ -214,6 +288,12 @@ func (h *BasicHost) newConnHandler(c network.Conn) {
 // newStreamHandler is the remote-opened stream handler for network.Network
 // TODO: this feels a bit wonky
 func (h *BasicHost) newStreamHandler(s network.Stream) {
+	if h.draining() {
+		h.logger.Debug("refused inbound stream, host is draining", zap.String("peer.id", s.Conn().RemotePeer().String()))
+		s.Reset()
+		return
+	}
+
 	if h.negtimeout > 0 {
 		if err := s.SetDeadline(time.Now().Add(h.negtimeout)); err != nil {
 			s.Reset()
@@ -227,6 +307,13 @@ func (h *BasicHost) newStreamHandler(s network.Stream) {
 		return
 	}
 
+	// move the stream out of the transient scope now that we know its protocol
+	if err := rcmgr.SetStreamProtocol(s, protocol.ID(protoID)); err != nil {
+		h.logger.Debug("refused inbound stream", zap.Error(err), zap.String("protocol", protoID))
+		s.Reset()
+		return
+	}
+
 	s = &streamWrapper{
 		Stream: s,
 		rw:     lzc,
@@ -257,20 +344,111 @@ func (h *BasicHost) background(ctx context.Context) {
 
 	// initialize lastAddrs
 	h.mx.Lock()
-	if h.lastAddrs == nil {
+	init := h.lastAddrs == nil
+	if init {
 		h.lastAddrs = h.Addrs()
 	}
+	addrs := h.lastAddrs
 	h.mx.Unlock()
+	if init {
+		h.updateSignedPeerRecord(addrs)
+	}
 
 	for {
 		select {
 		case <-ticker.C:
+			h.checkForAddrChanges()
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// checkForAddrChanges compares our current addresses with the ones we saw
+// last time, and if they differ signs a new peer record and emits an
+// EvtLocalAddressesUpdated. The identify service uses this to push the changes
+// to connected peers.
+func (h *BasicHost) checkForAddrChanges() {
+	curr := h.Addrs()
+
+	h.mx.Lock()
+	prev := h.lastAddrs
+	h.lastAddrs = curr
+	h.mx.Unlock()
+
+	added, removed := diffAddrs(prev, curr)
+	if len(added) == 0 && len(removed) == 0 {
+		return
+	}
+	h.emitters.evtLocalAddressesUpdated.Emit(eventbus.EvtLocalAddressesUpdated{
+		Added:            added,
+		Removed:          removed,
+		SignedPeerRecord: h.updateSignedPeerRecord(curr),
+	})
+}
+
+// SignedPeerRecord returns the latest signed record of the addresses of the
+// host, which is renewed whenever Addrs changes. It returns nil if the private
+// key of the host isn't in the peerstore.
+func (h *BasicHost) SignedPeerRecord() *record.Envelope {
+	h.mx.Lock()
+	env := h.signedRecord
+	h.mx.Unlock()
+	if env != nil {
+		return env
+	}
+	return h.updateSignedPeerRecord(h.Addrs())
+}
+
+// updateSignedPeerRecord signs a peer record of addrs with the key of the
+// host, and stores it in the peerstore if it has a certified address book.
+func (h *BasicHost) updateSignedPeerRecord(addrs []ma.Multiaddr) *record.Envelope {
+	h.recordMu.Lock()
+	defer h.recordMu.Unlock()
+
+	sk := h.Peerstore().PrivKey(h.ID())
+	if sk == nil {
+		h.logger.Warn("unable to sign peer record, private key of the host unknown")
+		return nil
+	}
+	env, err := record.PeerRecordFromAddrInfo(peer.AddrInfo{ID: h.ID(), Addrs: addrs}).Sign(sk)
+	if err != nil {
+		h.logger.Error("failed to sign peer record", zap.Error(err))
+		return nil
+	}
+	h.mx.Lock()
+	h.signedRecord = env
+	h.mx.Unlock()
+	if cab, ok := pstore.GetCertifiedAddrBook(h.Peerstore()); ok {
+		if _, err := cab.ConsumePeerRecord(env, peerstore.PermanentAddrTTL); err != nil {
+			h.logger.Error("failed to store own peer record", zap.Error(err))
+		}
+	}
+	return env
+}
+
+// diffAddrs returns the addresses only present in curr, and the addresses only
+// present in prev
+func diffAddrs(prev, curr []ma.Multiaddr) (added, removed []ma.Multiaddr) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, a := range prev {
+		prevSet[string(a.Bytes())] = struct{}{}
+	}
+	currSet := make(map[string]struct{}, len(curr))
+	for _, a := range curr {
+		currSet[string(a.Bytes())] = struct{}{}
+		if _, ok := prevSet[string(a.Bytes())]; !ok {
+			added = append(added, a)
+		}
+	}
+	for _, a := range prev {
+		if _, ok := currSet[string(a.Bytes())]; !ok {
+			removed = append(removed, a)
+		}
+	}
+	return added, removed
+}
+
 // ID returns the (local) peer.ID associated with this Host
 func (h *BasicHost) ID() peer.ID {
 	return h.Network().LocalPeer()
@@ -301,6 +479,7 @@ func (h *BasicHost) EventBus() event.Bus {
 //   host.Mux().SetHandler(proto, handler)
 // (Threadsafe)
 func (h *BasicHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	handler = h.mw.Wrap(handler)
 	h.Mux().AddHandler(string(pid), func(p string, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		is.SetProtocol(protocol.ID(p))
@@ -315,6 +494,7 @@ func (h *BasicHost) SetStreamHandler(pid protocol.ID, handler network.StreamHand
 // SetStreamHandlerMatch sets the protocol handler on the Host's Mux
 // using a matching function to do protocol comparisons
 func (h *BasicHost) SetStreamHandlerMatch(pid protocol.ID, m func(string) bool, handler network.StreamHandler) {
+	handler = h.mw.Wrap(handler)
 	h.Mux().AddHandlerWithFunc(string(pid), m, func(p string, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		is.SetProtocol(protocol.ID(p))
@@ -337,8 +517,30 @@ func (h *BasicHost) RemoveStreamHandler(pid protocol.ID) {
 // NewStream opens a new stream to given peer p, and writes a p2p/protocol
 // header with given protocol.ID. If there is no connection to p, attempts
 // to create one. If ProtocolID is "", writes no header.
+// If p is known to support one of pids, the protocol is negotiated lazily:
+// the header is sent with the first write and a refusal reported by the
+// first read.
+// The stream is run through the middlewares of its protocol.
 // (Threadsafe)
 func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
+	s, err := h.openStream(ctx, p, pids...)
+	if err != nil {
+		return nil, err
+	}
+	return h.mw.Outbound(s)
+}
+
+// Use registers stream middlewares applying to every protocol
+func (h *BasicHost) Use(mws ...middleware.Middleware) {
+	h.mw.Use(mws...)
+}
+
+// UseFor registers stream middlewares applying to pid only
+func (h *BasicHost) UseFor(pid protocol.ID, mws ...middleware.Middleware) {
+	h.mw.UseFor(pid, mws...)
+}
+
+func (h *BasicHost) openStream(ctx context.Context, p peer.ID, pids ...protocol.ID) (network.Stream, error) {
 	pref, err := h.preferredProtocol(p, pids)
 	if err != nil {
 		return nil, err
@@ -364,6 +566,10 @@ func (h *BasicHost) NewStream(ctx context.Context, p peer.ID, pids ...protocol.I
 		return nil, err
 	}
 	selpid := protocol.ID(selected)
+	if err := rcmgr.SetStreamProtocol(s, selpid); err != nil {
+		s.Reset()
+		return nil, err
+	}
 	s.SetProtocol(selpid)
 	h.Peerstore().AddProtocols(p, selected)
 
@@ -398,13 +604,19 @@ func (h *BasicHost) newStream(ctx context.Context, p peer.ID, pid protocol.ID) (
 		return nil, err
 	}
 
+	if err := rcmgr.SetStreamProtocol(s, pid); err != nil {
+		s.Reset()
+		return nil, err
+	}
 	s.SetProtocol(pid)
 
-	lzcon := msmux.NewMSSelect(s, string(pid))
-	return &streamWrapper{
-		Stream: s,
-		rw:     lzcon,
-	}, nil
+	// the peer is known to support pid, so save a round trip by negotiating
+	// it lazily. Should the peer refuse it, forget it supports pid so that
+	// the next streams fall back to a full negotiation.
+	return newLazyStream(s, pid, func(err error) {
+		h.logger.Debug("lazy protocol negotiation failed", zap.String("peer.id", p.String()), zap.String("protocol", string(pid)), zap.Error(err))
+		h.Peerstore().RemoveProtocols(p, string(pid))
+	}), nil
 }
 
 // Connect ensures there is a connection between this host and the peer with
@@ -494,21 +706,46 @@ func (h *BasicHost) resolveAddrs(ctx context.Context, pi peer.AddrInfo) ([]ma.Mu
 // dialPeer opens a connection to peer, and makes sure to identify
 // the connection once it has been opened.
 func (h *BasicHost) dialPeer(ctx context.Context, p peer.ID) error {
-	_, err := h.Network().DialPeer(ctx, p)
+	c, err := h.Network().DialPeer(ctx, p)
 	if err != nil {
 		return err
 	}
 
+	// identify the connection before returning
+	if h.ids != nil {
+		select {
+		case <-h.ids.IdentifyWait(c):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	}
+
 	// Clear protocols on connecting to new peer to avoid issues caused
 	// by misremembering protocols between reconnects
 	return h.Peerstore().SetProtocols(p)
 }
 
+// IDService returns the identify service, or nil if it is disabled
+func (h *BasicHost) IDService() *identify.IDService {
+	return h.ids
+}
+
+// PingService returns the ping service, or nil if it is disabled
+func (h *BasicHost) PingService() *ping.PingService {
+	return h.pings
+}
+
 // ConnManager returns the underlying connection manager
 func (h *BasicHost) ConnManager() connmgr.ConnManager {
 	return h.cmgr
 }
 
+// NATManager returns the NAT manager, or nil if NAT port mapping is disabled
+func (h *BasicHost) NATManager() NATManager {
+	return h.natmgr
+}
+
 // Addrs returns listening addresses that are safe to announce to the network.
 // The output is the same as AllAddrs, but processed by AddrsFactory.
 func (h *BasicHost) Addrs() []ma.Multiaddr {
@@ -649,6 +886,12 @@ func (h *BasicHost) AllAddrs() []ma.Multiaddr {
 
 // Close shuts down the Host's services (network, etc).
 func (h *BasicHost) Close() error {
+	if h.ids != nil {
+		h.ids.Close()
+	}
+	if h.pings != nil {
+		h.pings.Close()
+	}
 	if h.natmgr != nil {
 		h.natmgr.Close()
 	}
@@ -656,6 +899,8 @@ func (h *BasicHost) Close() error {
 		h.cmgr.Close()
 	}
 	h.emitters.evtLocalProtocolsUpdated.Close()
+	h.emitters.evtLocalAddressesUpdated.Close()
+	h.emitters.evtPeerGoingAway.Close()
 	return h.Network().Close()
 }
 
@@ -664,6 +909,14 @@ type streamWrapper struct {
 	rw io.ReadWriter
 }
 
+// Scope returns the resource scope of the wrapped stream, if any
+func (s *streamWrapper) Scope() *rcmgr.StreamScope {
+	if sc, ok := s.Stream.(rcmgr.Scoped); ok {
+		return sc.Scope()
+	}
+	return nil
+}
+
 func (s *streamWrapper) Read(b []byte) (int, error) {
 	return s.rw.Read(b)
 }
@@ -3,9 +3,12 @@ package basichost
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"reflect"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -16,12 +19,17 @@ import (
 	"github.com/RTradeLtd/libp2px-core/peer"
 	"github.com/RTradeLtd/libp2px-core/protocol"
 	"github.com/RTradeLtd/libp2px-core/test"
+	middleware "github.com/RTradeLtd/libp2px/p2p/host/middleware"
 	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	identify "github.com/RTradeLtd/libp2px/pkg/identify"
+	pstore "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	record "github.com/RTradeLtd/libp2px/pkg/record"
 	"go.uber.org/zap/zaptest"
 
 	swarmt "github.com/RTradeLtd/libp2px/pkg/swarm/testing"
 	ma "github.com/multiformats/go-multiaddr"
 	madns "github.com/multiformats/go-multiaddr-dns"
+	msmux "github.com/multiformats/go-multistream"
 )
 
 func TestHostDoubleClose(t *testing.T) {
@@ -125,6 +133,73 @@ func TestProtocolHandlerEvents(t *testing.T) {
 	assert(nil, []protocol.ID{protocol.TestingID})
 }
 
+func TestConnEvents(t *testing.T) {
+	ctx := context.Background()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1 := New(ctx, s1, zaptest.NewLogger(t))
+	defer h1.Close()
+	h2 := New(ctx, s2, zaptest.NewLogger(t))
+	defer h2.Close()
+
+	sub, err := h1.EventBus().Subscribe([]interface{}{
+		&eventbus.EvtPeerConnectednessChanged{},
+		&eventbus.EvtConnOpened{},
+		&eventbus.EvtConnClosed{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	next := func() interface{} {
+		select {
+		case evt := <-sub.Out():
+			return evt
+		case <-time.After(5 * time.Second):
+			t.Fatal("event not received in 5 seconds")
+			return nil
+		}
+	}
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+	opened, ok := next().(eventbus.EvtConnOpened)
+	if !ok || opened.Conn.RemotePeer() != h2.ID() || opened.Transport != "tcp" || opened.Direction != network.DirOutbound {
+		t.Fatalf("unexpected opened event %+v", opened)
+	}
+	if evt := next(); evt != (eventbus.EvtPeerConnectednessChanged{Peer: h2.ID(), Connectedness: network.Connected}) {
+		t.Fatalf("unexpected event %+v", evt)
+	}
+
+	// closing on the remote side
+	if err := h2.Network().ClosePeer(h1.ID()); err != nil {
+		t.Fatal(err)
+	}
+	closed, ok := next().(eventbus.EvtConnClosed)
+	if !ok || closed.Conn != opened.Conn || closed.Reason != eventbus.CloseRemote {
+		t.Fatalf("unexpected closed event %+v", closed)
+	}
+	if evt := next(); evt != (eventbus.EvtPeerConnectednessChanged{Peer: h2.ID(), Connectedness: network.NotConnected}) {
+		t.Fatalf("unexpected event %+v", evt)
+	}
+
+	// and on ours
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+	next()
+	next()
+	if err := h1.Network().ClosePeer(h2.ID()); err != nil {
+		t.Fatal(err)
+	}
+	if closed, ok := next().(eventbus.EvtConnClosed); !ok || closed.Reason != eventbus.CloseLocal {
+		t.Fatalf("unexpected closed event %+v", closed)
+	}
+}
+
 func TestHostAddrsFactory(t *testing.T) {
 	maddr := ma.StringCast("/ip4/1.2.3.4/tcp/1234")
 	addrsFactory := func(addrs []ma.Multiaddr) []ma.Multiaddr {
@@ -146,6 +221,110 @@ func TestHostAddrsFactory(t *testing.T) {
 	}
 }
 
+func TestHostIdentify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1, err := NewHost(ctx, s1, &HostOpts{EnableIdentify: true}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := NewHost(ctx, s2, &HostOpts{
+		EnableIdentify: true,
+		UserAgent:      "test/0.0.1",
+		IdentifyOpts:   []identify.Option{identify.DiscloseObservedAddr(false)},
+	}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+	h2.SetStreamHandler(protocol.TestingID, func(s network.Stream) { s.Close() })
+
+	sub, err := h1.EventBus().Subscribe(&event.EvtPeerIdentificationCompleted{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case evt := <-sub.Out():
+		if evt.(event.EvtPeerIdentificationCompleted).Peer != h2.ID() {
+			t.Fatal("identified the wrong peer")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("identification did not complete")
+	}
+
+	protos, err := h1.Peerstore().SupportsProtocols(h2.ID(), string(protocol.TestingID), identify.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protos) != 2 {
+		t.Fatalf("expected identify to record 2 protocols, got %v", protos)
+	}
+	av, err := h1.Peerstore().Get(h2.ID(), "AgentVersion")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if av.(string) != "test/0.0.1" {
+		t.Fatalf("unexpected agent version %s", av)
+	}
+}
+
+func TestHostIdentifyDelta(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1, err := NewHost(ctx, s1, &HostOpts{EnableIdentify: true}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := NewHost(ctx, s2, &HostOpts{EnableIdentify: true}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := h1.EventBus().Subscribe(&event.EvtPeerProtocolsUpdated{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	h2.SetStreamHandler(protocol.TestingID, func(s network.Stream) { s.Close() })
+	select {
+	case evt := <-sub.Out():
+		upd := evt.(event.EvtPeerProtocolsUpdated)
+		if upd.Peer != h2.ID() || !reflect.DeepEqual(upd.Added, []protocol.ID{protocol.TestingID}) {
+			t.Fatalf("unexpected protocol update %+v", upd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("delta was not pushed")
+	}
+	protos, err := h1.Peerstore().SupportsProtocols(h2.ID(), string(protocol.TestingID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(protos) != 1 {
+		t.Fatal("pushed protocol was not recorded")
+	}
+}
+
 func getHostPair(ctx context.Context, t *testing.T) (host.Host, host.Host) {
 	t.Helper()
 	s1, closer1 := swarmt.GenSwarm(t, ctx)
@@ -265,7 +444,6 @@ func TestHostProtoMismatch(t *testing.T) {
 }
 
 func TestHostProtoPreknowledge(t *testing.T) {
-	t.Skip("this test is failing and im not sure why")
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 	s1, closer1 := swarmt.GenSwarm(t, ctx)
@@ -291,6 +469,8 @@ func TestHostProtoPreknowledge(t *testing.T) {
 	defer h2.Close()
 
 	h1.SetStreamHandler("/foo", handler)
+	// identify being opt-in, tell h2 what h1 supports
+	h2.Peerstore().AddProtocols(h1.ID(), "/super")
 
 	s, err := h2.NewStream(ctx, h1.ID(), "/foo", "/bar", "/super")
 	if err != nil {
@@ -524,3 +704,297 @@ func (sma sortedMultiaddrs) Swap(i, j int) { sma[i], sma[j] = sma[j], sma[i] }
 func (sma sortedMultiaddrs) Less(i, j int) bool {
 	return bytes.Compare(sma[i].Bytes(), sma[j].Bytes()) == 1
 }
+
+func TestHostSignedPeerRecord(t *testing.T) {
+	ctx := context.Background()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+
+	var mu sync.Mutex
+	addrs := []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/1234")}
+	h := New(ctx, s1, zaptest.NewLogger(t), AddrsFactory(func([]ma.Multiaddr) []ma.Multiaddr {
+		mu.Lock()
+		defer mu.Unlock()
+		return addrs
+	}))
+	defer h.Close()
+
+	sub, err := h.EventBus().Subscribe(&eventbus.EvtLocalAddressesUpdated{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	checkRecord := func(env *record.Envelope, expected ma.Multiaddr) *record.PeerRecord {
+		t.Helper()
+		if env == nil {
+			t.Fatal("expected a signed peer record")
+		}
+		rec, err := env.Record()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prec := rec.(*record.PeerRecord)
+		if prec.PeerID != h.ID() || len(prec.Addrs) != 1 || !prec.Addrs[0].Equal(expected) {
+			t.Fatalf("unexpected peer record %+v", prec)
+		}
+		return prec
+	}
+	first := checkRecord(h.SignedPeerRecord(), addrs[0])
+	h.mx.Lock()
+	h.lastAddrs = h.Addrs()
+	h.mx.Unlock()
+
+	mu.Lock()
+	addrs = []ma.Multiaddr{ma.StringCast("/ip4/1.2.3.4/tcp/4321")}
+	mu.Unlock()
+	h.checkForAddrChanges()
+
+	select {
+	case evt := <-sub.Out():
+		second := checkRecord(evt.(eventbus.EvtLocalAddressesUpdated).SignedPeerRecord, addrs[0])
+		if second.Seq <= first.Seq {
+			t.Fatal("record sequence number did not increase")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no address update was emitted")
+	}
+	cab, ok := pstore.GetCertifiedAddrBook(h.Peerstore())
+	if !ok {
+		t.Fatal("expected a certified address book")
+	}
+	if !cab.GetPeerRecord(h.ID()).Equal(h.SignedPeerRecord()) {
+		t.Fatal("own record was not stored in the peerstore")
+	}
+}
+
+func TestHostDrain(t *testing.T) {
+	ctx := context.Background()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1, err := NewHost(ctx, s1, &HostOpts{NotifyPeersOnDrain: true}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h1.Close()
+	h2, err := NewHost(ctx, s2, &HostOpts{NotifyPeersOnDrain: true}, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h2.Close()
+
+	h1.SetStreamHandler(protocol.TestingID, func(s network.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+	hookRan := make(chan struct{})
+	h1.AddDrainHook(func(context.Context) error {
+		close(hookRan)
+		return nil
+	})
+	sub, err := h2.EventBus().Subscribe(&eventbus.EvtPeerGoingAway{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := h2.Connect(ctx, h1.Peerstore().PeerInfo(h1.ID())); err != nil {
+		t.Fatal(err)
+	}
+	s, err := h2.NewStream(ctx, h1.ID(), protocol.TestingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// outbound streams of the draining host aren't waited for
+	h2.SetStreamHandler("/idle", func(s network.Stream) {})
+	idle, err := h1.NewStream(ctx, h2.ID(), "/idle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer idle.Reset()
+	buf := []byte("ping")
+	if _, err := s.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		drained <- h1.Drain(dctx)
+	}()
+
+	select {
+	case <-hookRan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain hook didn't run")
+	}
+	select {
+	case evt := <-sub.Out():
+		if p := evt.(eventbus.EvtPeerGoingAway).Peer; p != h1.ID() {
+			t.Fatalf("go away from unexpected peer %s", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("peer wasn't told the host is going away")
+	}
+	if len(h1.Network().ListenAddresses()) != 0 {
+		t.Fatal("draining host is still listening")
+	}
+	if _, err := h2.NewStream(ctx, h1.ID(), "/other"); err == nil {
+		t.Fatal("draining host accepted a new stream")
+	}
+
+	// the drain waits for the active stream to finish
+	select {
+	case err := <-drained:
+		t.Fatalf("drain returned with an active stream: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	s.Close()
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-drained:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain didn't finish")
+	}
+	if err := h1.Drain(ctx); err != ErrDraining {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+
+	// hosts not configured for go away notices don't speak the protocol
+	s3, closer3 := swarmt.GenSwarm(t, ctx)
+	defer closer3()
+	h3 := New(ctx, s3, zaptest.NewLogger(t))
+	defer h3.Close()
+	for _, p := range h3.Mux().Protocols() {
+		if p == GoAwayProtocol {
+			t.Fatal("go away handler registered without NotifyPeersOnDrain")
+		}
+	}
+}
+
+func TestHostMiddleware(t *testing.T) {
+	ctx := context.Background()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1 := New(ctx, s1, zaptest.NewLogger(t))
+	defer h1.Close()
+	h2 := New(ctx, s2, zaptest.NewLogger(t))
+	defer h2.Close()
+
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	observe := func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			mu.Lock()
+			seen = append(seen, fmt.Sprintf("%d %s %s", s.Stat().Direction, s.Protocol(), s.Conn().RemotePeer()))
+			mu.Unlock()
+			next(s)
+		}
+	}
+	h1.Use(observe, middleware.Recover(zaptest.NewLogger(t)))
+	h2.Use(observe)
+	h2.UseFor("/refused", middleware.AllowPeers(func(peer.ID) bool { return false }))
+	h1.SetStreamHandler("/refused", func(s network.Stream) { s.Close() })
+
+	done := make(chan struct{})
+	h1.SetStreamHandler(protocol.TestingID, func(s network.Stream) {
+		defer close(done)
+		s.Read(make([]byte, 1))
+		panic("handler failure")
+	})
+	if err := h2.Connect(ctx, h1.Peerstore().PeerInfo(h1.ID())); err != nil {
+		t.Fatal(err)
+	}
+	s, err := h2.NewStream(ctx, h1.ID(), protocol.TestingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Write([]byte("x"))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler wasn't called")
+	}
+	// the panic is recovered and the stream reset
+	if _, err := s.Read(make([]byte, 1)); err == nil {
+		t.Fatal("expected the stream to be reset")
+	}
+
+	mu.Lock()
+	sort.Strings(seen)
+	expected := []string{
+		fmt.Sprintf("%d %s %s", network.DirInbound, protocol.TestingID, h2.ID()),
+		fmt.Sprintf("%d %s %s", network.DirOutbound, protocol.TestingID, h1.ID()),
+	}
+	if !reflect.DeepEqual(seen, expected) {
+		t.Fatalf("unexpected streams seen by the middlewares: %v", seen)
+	}
+	mu.Unlock()
+
+	if _, err := h2.NewStream(ctx, h1.ID(), "/refused"); err != middleware.ErrRefused {
+		t.Fatalf("expected ErrRefused, got %v", err)
+	}
+}
+
+func TestHostLazyNegotiationFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	h1, h2 := getHostPair(ctx, t)
+	defer h1.Close()
+	defer h2.Close()
+
+	closed := make(chan struct{})
+	h1.SetStreamHandler("/closed", func(s network.Stream) {
+		close(closed)
+		s.Close()
+	})
+	h2.Peerstore().AddProtocols(h1.ID(), "/closed", "/stale")
+
+	// a stream closed without any write is still negotiated
+	s, err := h2.NewStream(ctx, h1.ID(), "/closed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler wasn't called for a stream closed without writes")
+	}
+
+	// the stale protocol is selected optimistically, the failure being
+	// reported by the first read
+	s, err = h2.NewStream(ctx, h1.ID(), "/stale")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Read(make([]byte, 1)); err != msmux.ErrNotSupported {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+	if protos, _ := h2.Peerstore().SupportsProtocols(h1.ID(), "/stale"); len(protos) != 0 {
+		t.Fatal("refused protocol wasn't removed from the peerstore")
+	}
+	// so the next stream is negotiated eagerly
+	if _, err := h2.NewStream(ctx, h1.ID(), "/stale"); err == nil {
+		t.Fatal("expected the negotiation to fail")
+	}
+}
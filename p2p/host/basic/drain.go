@@ -0,0 +1,206 @@
+package basichost
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px/pkg/eventbus"
+	"github.com/RTradeLtd/libp2px/pkg/identify"
+	"github.com/RTradeLtd/libp2px/pkg/ping"
+	"github.com/RTradeLtd/libp2px/pkg/rcmgr"
+	msmux "github.com/multiformats/go-multistream"
+	"go.uber.org/zap"
+)
+
+// GoAwayProtocol is the protocol draining hosts use to tell their peers they
+// are going away
+const GoAwayProtocol = "/libp2px/goaway/1.0.0"
+
+// drainPollInterval is how often Drain checks whether the active streams
+// have finished
+const drainPollInterval = 20 * time.Millisecond
+
+// ErrDraining is returned by Drain when the host is already draining
+var ErrDraining = errors.New("host is already draining")
+
+// DrainHook is run by Drain before the host stops accepting connections and
+// streams, letting services such as pubsub or relays leave cleanly
+type DrainHook func(ctx context.Context) error
+
+// Drainer is implemented by hosts able to shut down gracefully
+type Drainer interface {
+	AddDrainHook(hook DrainHook)
+	Drain(ctx context.Context) error
+}
+
+var _ Drainer = (*BasicHost)(nil)
+
+// drainState tracks the hooks and progress of a drain
+type drainState struct {
+	draining int32 // accessed atomically
+
+	mu    sync.Mutex
+	hooks []DrainHook
+}
+
+// AddDrainHook registers hook to be run, in registration order, when the
+// host starts draining
+func (h *BasicHost) AddDrainHook(hook DrainHook) {
+	h.drain.mu.Lock()
+	h.drain.hooks = append(h.drain.hooks, hook)
+	h.drain.mu.Unlock()
+}
+
+// Drain gracefully shuts the host down. It runs the drain hooks, stops the
+// listeners, resets new inbound streams, tells the connected peers it is
+// going away if configured to, and closes the host once the inbound streams
+// open when the drain started have finished or ctx expires, in which case
+// ctx's error is returned. The streams of the identify, ping and go away
+// protocols, and the outbound ones, aren't waited for. Long lived streams
+// such as pubsub ones should be closed by a drain hook, Drain being bounded
+// by ctx otherwise.
+func (h *BasicHost) Drain(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&h.drain.draining, 0, 1) {
+		return ErrDraining
+	}
+	active := h.activeStreams()
+
+	h.drain.mu.Lock()
+	hooks := h.drain.hooks
+	h.drain.mu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			h.logger.Warn("drain hook failed", zap.Error(err))
+		}
+	}
+
+	// stop accepting connections, new inbound streams being refused by
+	// newStreamHandler from now on
+	if l, ok := h.network.(interface{ CloseListeners() error }); ok {
+		if err := l.CloseListeners(); err != nil {
+			h.logger.Warn("failed to close listeners", zap.Error(err))
+		}
+	}
+
+	if h.notifyOnDrain {
+		h.sendGoAway(ctx)
+	}
+
+	err := h.awaitStreams(ctx, active)
+	if cerr := h.Close(); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// draining returns whether Drain was called
+func (h *BasicHost) draining() bool {
+	return atomic.LoadInt32(&h.drain.draining) == 1
+}
+
+// activeStreams returns the open inbound streams Drain waits for
+func (h *BasicHost) activeStreams() map[network.Stream]struct{} {
+	active := make(map[network.Stream]struct{})
+	for _, c := range h.network.Conns() {
+		for _, s := range c.GetStreams() {
+			if s.Stat().Direction != network.DirInbound {
+				continue
+			}
+			switch s.Protocol() {
+			case identify.ID, identify.IDPush, identify.IDDelta, ping.ID, GoAwayProtocol:
+				continue
+			}
+			active[s] = struct{}{}
+		}
+	}
+	return active
+}
+
+// awaitStreams blocks until none of the streams of streams is open anymore,
+// or ctx expires
+func (h *BasicHost) awaitStreams(ctx context.Context, streams map[network.Stream]struct{}) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		active := 0
+		for _, c := range h.network.Conns() {
+			for _, s := range c.GetStreams() {
+				if _, ok := streams[s]; ok {
+					active++
+				}
+			}
+		}
+		if active == 0 {
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			h.logger.Warn("closing host with active streams", zap.Int("streams", active))
+			return ctx.Err()
+		}
+	}
+}
+
+// sendGoAway tells every connected peer we are going away, in parallel
+func (h *BasicHost) sendGoAway(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, p := range h.network.Peers() {
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer wg.Done()
+			if err := h.goAway(ctx, p); err != nil {
+				h.logger.Debug("failed to send go away", zap.String("peer.id", p.String()), zap.Error(err))
+			}
+		}(p)
+	}
+	wg.Wait()
+}
+
+// goAway tells p we are going away, waiting for it to acknowledge by closing
+// the stream
+func (h *BasicHost) goAway(ctx context.Context, p peer.ID) error {
+	s, err := h.network.NewStream(ctx, p)
+	if err != nil {
+		return err
+	}
+	if err := rcmgr.SetStreamProtocol(s, GoAwayProtocol); err != nil {
+		s.Reset()
+		return err
+	}
+	s.SetProtocol(GoAwayProtocol)
+	timeout := h.negtimeout
+	if timeout <= 0 {
+		timeout = DefaultNegotiationTimeout
+	}
+	s.SetDeadline(time.Now().Add(timeout))
+	if err := msmux.SelectProtoOrFail(GoAwayProtocol, s); err != nil {
+		s.Reset()
+		return err
+	}
+	s.Close()
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		s.Reset()
+		return err
+	}
+	return nil
+}
+
+// handleGoAway emits EvtPeerGoingAway when a peer announces it is draining
+func (h *BasicHost) handleGoAway(s network.Stream) {
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		s.Reset()
+		return
+	}
+	s.Close()
+	if err := h.emitters.evtPeerGoingAway.Emit(eventbus.EvtPeerGoingAway{Peer: s.Conn().RemotePeer()}); err != nil {
+		h.logger.Debug("failed to emit go away event", zap.Error(err))
+	}
+}
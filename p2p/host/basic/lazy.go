@@ -0,0 +1,124 @@
+package basichost
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+	"github.com/RTradeLtd/libp2px/pkg/rcmgr"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// lazyStream negotiates its protocol optimistically, for peers known to
+// support it: the multistream header is sent along with the first write,
+// saving a round trip, and the answer of the peer is checked on the first
+// read. Should the peer refuse the protocol, the first read fails, the stream
+// is reset and onFail is called.
+type lazyStream struct {
+	network.Stream
+	proto  protocol.ID
+	onFail func(error)
+
+	wOnce sync.Once
+	werr  error
+
+	rOnce sync.Once
+	rerr  error
+}
+
+func newLazyStream(s network.Stream, proto protocol.ID, onFail func(error)) *lazyStream {
+	return &lazyStream{Stream: s, proto: proto, onFail: onFail}
+}
+
+// header returns the multistream header selecting the protocol
+func (s *lazyStream) header() []byte {
+	var buf []byte
+	for _, tok := range []string{msmux.ProtocolID, string(s.proto)} {
+		var vbuf [binary.MaxVarintLen64]byte
+		buf = append(buf, vbuf[:binary.PutUvarint(vbuf[:], uint64(len(tok)+1))]...)
+		buf = append(buf, tok...)
+		buf = append(buf, '\n')
+	}
+	return buf
+}
+
+// writeHeader sends the header followed by data in a single write,
+// returning the number of bytes of data written
+func (s *lazyStream) writeHeader(data []byte) int {
+	header := s.header()
+	n, err := s.Stream.Write(append(header, data...))
+	s.werr = err
+	if n -= len(header); n < 0 {
+		n = 0
+	}
+	return n
+}
+
+func (s *lazyStream) Write(b []byte) (int, error) {
+	n, first := 0, false
+	s.wOnce.Do(func() {
+		first = true
+		n = s.writeHeader(b)
+	})
+	if first || s.werr != nil {
+		return n, s.werr
+	}
+	return s.Stream.Write(b)
+}
+
+func (s *lazyStream) Read(b []byte) (int, error) {
+	s.rOnce.Do(func() {
+		s.wOnce.Do(func() { s.writeHeader(nil) })
+		if s.werr != nil {
+			s.rerr = s.werr
+			return
+		}
+		var refused bool
+		if refused, s.rerr = s.readHandshake(); refused {
+			s.Stream.Reset()
+			if s.onFail != nil {
+				s.onFail(s.rerr)
+			}
+		}
+	})
+	if s.rerr != nil || len(b) == 0 {
+		// an empty read only waits for the negotiation to complete
+		return 0, s.rerr
+	}
+	return s.Stream.Read(b)
+}
+
+// readHandshake checks that the peer echoed the header, returning whether
+// the peer refused the protocol as opposed to the stream failing
+func (s *lazyStream) readHandshake() (bool, error) {
+	for _, expected := range []string{msmux.ProtocolID, string(s.proto)} {
+		tok, err := msmux.ReadNextToken(s.Stream)
+		if err != nil {
+			return false, err
+		}
+		if tok == "na" {
+			return true, msmux.ErrNotSupported
+		}
+		if tok != expected {
+			return true, fmt.Errorf("protocol mismatch in lazy handshake (%s != %s)", tok, expected)
+		}
+	}
+	return false, nil
+}
+
+// Close sends the header first if nothing was written, so that the peer
+// handles the stream even if it carries no data
+func (s *lazyStream) Close() error {
+	s.wOnce.Do(func() { s.writeHeader(nil) })
+	return s.Stream.Close()
+}
+
+// Scope returns the resource scope of the wrapped stream, if any
+func (s *lazyStream) Scope() *rcmgr.StreamScope {
+	if sc, ok := s.Stream.(rcmgr.Scoped); ok {
+		return sc.Scope()
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"go.uber.org/zap"
+)
+
+// Recover resets the streams whose handler panics instead of crashing the
+// process, logging the panic
+func Recover(logger *zap.Logger) Middleware {
+	logger = logger.Named("middleware")
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.Error("stream handler panicked",
+						zap.String("protocol", string(s.Protocol())),
+						zap.String("peer.id", s.Conn().RemotePeer().String()),
+						zap.Any("panic", r))
+					s.Reset()
+				}
+			}()
+			next(s)
+		}
+	}
+}
+
+// Deadline sets a deadline of timeout from now on the streams
+func Deadline(timeout time.Duration) Middleware {
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			if err := s.SetDeadline(time.Now().Add(timeout)); err != nil {
+				s.Reset()
+				return
+			}
+			next(s)
+		}
+	}
+}
+
+// AllowPeers refuses the streams of the remote peers allow returns false for
+func AllowPeers(allow func(peer.ID) bool) Middleware {
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			if !allow(s.Conn().RemotePeer()) {
+				s.Reset()
+				return
+			}
+			next(s)
+		}
+	}
+}
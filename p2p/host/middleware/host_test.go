@@ -0,0 +1,75 @@
+package middleware_test
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+	"github.com/RTradeLtd/libp2px/p2p/host/middleware"
+	blankhost "github.com/RTradeLtd/libp2px/pkg/blankhost"
+	swarmt "github.com/RTradeLtd/libp2px/pkg/swarm/testing"
+)
+
+// tag writes name to the streams before handing them to the next handler
+func tag(name string) middleware.Middleware {
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			s.Write([]byte(name))
+			next(s)
+		}
+	}
+}
+
+func TestBlankHostMiddleware(t *testing.T) {
+	ctx := context.Background()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1 := blankhost.NewBlankHost(s1)
+	defer h1.Close()
+	h2 := blankhost.NewBlankHost(s2)
+	defer h2.Close()
+
+	h1.Use(tag("g"))
+	h1.UseFor("/a", tag("a"))
+	echo := func(s network.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	}
+	h1.SetStreamHandler("/a", echo)
+	h1.SetStreamHandler("/b", echo)
+	h1.SetStreamHandler("/refused", echo)
+	h2.UseFor("/refused", middleware.AllowPeers(func(peer.ID) bool { return false }))
+
+	if err := h2.Connect(ctx, peer.AddrInfo{ID: h1.ID(), Addrs: h1.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+
+	for pid, expected := range map[protocol.ID]string{"/a": "ga.", "/b": "g."} {
+		s, err := h2.NewStream(ctx, h1.ID(), pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := s.Write([]byte(".")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, len(expected))
+		if _, err := io.ReadFull(s, buf); err != nil {
+			t.Fatal(err)
+		}
+		if string(buf) != expected {
+			t.Fatalf("expected %s to go through %q, got %q", pid, expected, buf)
+		}
+		s.Close()
+	}
+
+	if _, err := h2.NewStream(ctx, h1.ID(), "/refused"); err != middleware.ErrRefused {
+		t.Fatalf("expected ErrRefused, got %v", err)
+	}
+}
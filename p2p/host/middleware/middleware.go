@@ -0,0 +1,109 @@
+// Package middleware lets hosts wrap the handling of their streams with
+// cross-cutting code such as access control, deadlines or panic recovery.
+//
+// Middlewares registered globally run first, in registration order, followed
+// by the ones registered for the protocol of the stream. They wrap both the
+// handlers of inbound streams and the streams returned by NewStream. For
+// outbound streams, the innermost handler hands the stream back to the
+// caller of NewStream, so code running after next returns does so before the
+// stream is used. A middleware refuses a stream by not calling next, and
+// must call it synchronously for outbound streams.
+package middleware
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+)
+
+// ErrRefused is returned by NewStream when a middleware refuses the stream
+var ErrRefused = errors.New("stream refused by middleware")
+
+// Middleware wraps a stream handler. The stream passed to the returned
+// handler has its protocol negotiated, or selected for outbound streams
+// that negotiate it lazily.
+type Middleware func(next network.StreamHandler) network.StreamHandler
+
+// Host is implemented by hosts supporting stream middlewares
+type Host interface {
+	// Use registers middlewares applying to the streams of every protocol
+	Use(mws ...Middleware)
+	// UseFor registers middlewares applying to the streams of pid only
+	UseFor(pid protocol.ID, mws ...Middleware)
+}
+
+// Chain is a set of global and per protocol middlewares. The zero value is
+// an empty chain ready to use.
+type Chain struct {
+	mu       sync.RWMutex
+	global   []Middleware
+	protocol map[protocol.ID][]Middleware
+}
+
+// Use registers middlewares applying to the streams of every protocol
+func (c *Chain) Use(mws ...Middleware) {
+	c.mu.Lock()
+	c.global = append(c.global, mws...)
+	c.mu.Unlock()
+}
+
+// UseFor registers middlewares applying to the streams of pid only
+func (c *Chain) UseFor(pid protocol.ID, mws ...Middleware) {
+	c.mu.Lock()
+	if c.protocol == nil {
+		c.protocol = make(map[protocol.ID][]Middleware)
+	}
+	c.protocol[pid] = append(c.protocol[pid], mws...)
+	c.mu.Unlock()
+}
+
+// build wraps handler with the middlewares applying to pid
+func (c *Chain) build(pid protocol.ID, handler network.StreamHandler) network.StreamHandler {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	specific := c.protocol[pid]
+	for i := len(specific) - 1; i >= 0; i-- {
+		handler = specific[i](handler)
+	}
+	for i := len(c.global) - 1; i >= 0; i-- {
+		handler = c.global[i](handler)
+	}
+	return handler
+}
+
+// Wrap returns a handler running handler through the middlewares applying to
+// the protocol of each stream, as registered at the time the stream arrives
+func (c *Chain) Wrap(handler network.StreamHandler) network.StreamHandler {
+	return func(s network.Stream) {
+		c.build(s.Protocol(), handler)(s)
+	}
+}
+
+// Outbound runs a newly opened stream through the middlewares applying to
+// its protocol, returning the stream handed to the innermost handler. The
+// stream is reset and ErrRefused returned if a middleware doesn't call next
+// before returning, later calls being ignored.
+func (c *Chain) Outbound(s network.Stream) (network.Stream, error) {
+	var (
+		mu       sync.Mutex
+		out      network.Stream
+		returned bool
+	)
+	c.build(s.Protocol(), func(s network.Stream) {
+		mu.Lock()
+		if !returned {
+			out = s
+		}
+		mu.Unlock()
+	})(s)
+	mu.Lock()
+	returned = true
+	mu.Unlock()
+	if out == nil {
+		s.Reset()
+		return nil, ErrRefused
+	}
+	return out, nil
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"testing"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+)
+
+type testStream struct {
+	network.Stream
+	proto protocol.ID
+	reset bool
+}
+
+func (s *testStream) Protocol() protocol.ID { return s.proto }
+
+func (s *testStream) Reset() error {
+	s.reset = true
+	return nil
+}
+
+func record(calls *[]string, name string) Middleware {
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			*calls = append(*calls, name)
+			next(s)
+		}
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var (
+		c     Chain
+		calls []string
+	)
+	c.UseFor("/a", record(&calls, "a1"))
+	c.Use(record(&calls, "g1"), record(&calls, "g2"))
+	c.UseFor("/a", record(&calls, "a2"))
+	c.UseFor("/b", record(&calls, "b"))
+
+	handler := c.Wrap(func(network.Stream) { calls = append(calls, "handler") })
+	handler(&testStream{proto: "/a"})
+	expected := []string{"g1", "g2", "a1", "a2", "handler"}
+	if len(calls) != len(expected) {
+		t.Fatalf("expected calls %v, got %v", expected, calls)
+	}
+	for i := range expected {
+		if calls[i] != expected[i] {
+			t.Fatalf("expected calls %v, got %v", expected, calls)
+		}
+	}
+
+	// middlewares registered after the handler apply as well
+	calls = nil
+	c.UseFor("/c", record(&calls, "c"))
+	handler(&testStream{proto: "/c"})
+	if len(calls) != 4 || calls[2] != "c" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestChainOutbound(t *testing.T) {
+	var c Chain
+	c.UseFor("/refused", func(network.StreamHandler) network.StreamHandler {
+		return func(network.Stream) {}
+	})
+
+	s := &testStream{proto: "/accepted"}
+	out, err := c.Outbound(s)
+	if err != nil || out != s {
+		t.Fatalf("expected the stream to be accepted, got %v, %v", out, err)
+	}
+
+	s = &testStream{proto: "/refused"}
+	if _, err := c.Outbound(s); err != ErrRefused {
+		t.Fatalf("expected ErrRefused, got %v", err)
+	}
+	if !s.reset {
+		t.Fatal("refused stream wasn't reset")
+	}
+
+	// next called once Outbound returned is ignored
+	called := make(chan struct{})
+	c.UseFor("/async", func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			go func() {
+				next(s)
+				close(called)
+			}()
+		}
+	})
+	if _, err := c.Outbound(&testStream{proto: "/async"}); err != ErrRefused {
+		t.Fatalf("expected ErrRefused, got %v", err)
+	}
+	<-called
+}
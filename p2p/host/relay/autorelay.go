@@ -83,6 +83,18 @@ func NewAutoRelay(ctx context.Context, logger *zap.Logger, bhost *basic.BasicHos
 	return ar
 }
 
+// Relays returns the relays we currently hold a connection to and
+// advertise addresses through
+func (ar *AutoRelay) Relays() []peer.ID {
+	ar.mx.Lock()
+	defer ar.mx.Unlock()
+	relays := make([]peer.ID, 0, len(ar.relays))
+	for p := range ar.relays {
+		relays = append(relays, p)
+	}
+	return relays
+}
+
 func (ar *AutoRelay) baseAddrs() []ma.Multiaddr {
 	return ar.addrsF(ar.host.AllAddrs())
 }
@@ -14,6 +14,8 @@ import (
 	"github.com/RTradeLtd/libp2px-core/protocol"
 	"go.uber.org/zap"
 
+	basichost "github.com/RTradeLtd/libp2px/p2p/host/basic"
+	middleware "github.com/RTradeLtd/libp2px/p2p/host/middleware"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -192,9 +194,49 @@ func (rh *RoutedHost) Close() error {
 	return rh.host.Close()
 }
 
+// AddDrainHook registers hook on the wrapped host, if it supports draining
+func (rh *RoutedHost) AddDrainHook(hook basichost.DrainHook) {
+	if d, ok := rh.host.(basichost.Drainer); ok {
+		d.AddDrainHook(hook)
+	}
+}
+
+// Drain gracefully shuts the wrapped host down, or closes it right away if it
+// doesn't support draining
+func (rh *RoutedHost) Drain(ctx context.Context) error {
+	if d, ok := rh.host.(basichost.Drainer); ok {
+		return d.Drain(ctx)
+	}
+	return rh.host.Close()
+}
+
+// Use registers stream middlewares applying to every protocol on the wrapped
+// host, if it supports them. A warning is logged otherwise, as the streams
+// then bypass the middlewares.
+func (rh *RoutedHost) Use(mws ...middleware.Middleware) {
+	if mh, ok := rh.host.(middleware.Host); ok {
+		mh.Use(mws...)
+		return
+	}
+	rh.logger.Warn("wrapped host doesn't support stream middlewares, ignoring them")
+}
+
+// UseFor registers stream middlewares applying to pid only on the wrapped
+// host, if it supports them. A warning is logged otherwise, as the streams
+// then bypass the middlewares.
+func (rh *RoutedHost) UseFor(pid protocol.ID, mws ...middleware.Middleware) {
+	if mh, ok := rh.host.(middleware.Host); ok {
+		mh.UseFor(pid, mws...)
+		return
+	}
+	rh.logger.Warn("wrapped host doesn't support stream middlewares, ignoring them", zap.String("protocol", string(pid)))
+}
+
 // ConnManager returns the underlying connection manager
 func (rh *RoutedHost) ConnManager() connmgr.ConnManager {
 	return rh.host.ConnManager()
 }
 
 var _ (host.Host) = (*RoutedHost)(nil)
+var _ basichost.Drainer = (*RoutedHost)(nil)
+var _ middleware.Host = (*RoutedHost)(nil)
@@ -0,0 +1,403 @@
+// Package admin serves the live state of a host as JSON, to debug running
+// nodes. The handler is read only, but exposes the peers and addresses of
+// the node, so it should only be served on a trusted interface.
+//
+// The handler serves the following paths, relative to where it is mounted:
+//
+//	/conns         connections, with their streams
+//	/peers/{id}    the peerstore entry of a peer
+//	/pubsub        pubsub topics, with their peers, mesh and fanout
+//	/routing       the peers of the kbucket routing table
+//	/nat           NAT port mappings
+//	/relay         relays we advertise addresses through, and relayed hops
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/host"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+
+	bhost "github.com/RTradeLtd/libp2px/p2p/host/basic"
+	relay "github.com/RTradeLtd/libp2px/p2p/host/relay"
+	kbucket "github.com/RTradeLtd/libp2px/pkg/kbucket"
+	"github.com/RTradeLtd/libp2px/pkg/metrics"
+	pubsub "github.com/RTradeLtd/libp2px/pkg/pubsub"
+	swarm "github.com/RTradeLtd/libp2px/pkg/swarm"
+	circuit "github.com/RTradeLtd/libp2px/pkg/transports/circuit"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// Option configures the components reported by a Handler
+type Option func(a *Handler) error
+
+// WithPubSub reports the topics of ps
+func WithPubSub(ps *pubsub.PubSub) Option {
+	return func(a *Handler) error {
+		a.pubsub = ps
+		return nil
+	}
+}
+
+// WithRoutingTable reports the peers of rt
+func WithRoutingTable(rt *kbucket.RoutingTable) Option {
+	return func(a *Handler) error {
+		a.routing = rt
+		return nil
+	}
+}
+
+// WithAutoRelay reports the relays used by ar
+func WithAutoRelay(ar *relay.AutoRelay) Option {
+	return func(a *Handler) error {
+		a.autorelay = ar
+		return nil
+	}
+}
+
+// WithRelay reports the hops relayed by r
+func WithRelay(r *circuit.Relay) Option {
+	return func(a *Handler) error {
+		a.relay = r
+		return nil
+	}
+}
+
+// Handler is an http.Handler serving the state of a host as JSON
+type Handler struct {
+	host      host.Host
+	pubsub    *pubsub.PubSub
+	routing   *kbucket.RoutingTable
+	autorelay *relay.AutoRelay
+	relay     *circuit.Relay
+
+	mux *http.ServeMux
+}
+
+// NewHandler returns a handler serving the state of h
+func NewHandler(h host.Host, opts ...Option) (*Handler, error) {
+	a := &Handler{
+		host: h,
+		mux:  http.NewServeMux(),
+	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+	a.mux.HandleFunc("/conns", a.serveConns)
+	a.mux.HandleFunc("/peers/", a.servePeer)
+	a.mux.HandleFunc("/pubsub", a.servePubSub)
+	a.mux.HandleFunc("/routing", a.serveRouting)
+	a.mux.HandleFunc("/nat", a.serveNAT)
+	a.mux.HandleFunc("/relay", a.serveRelay)
+	return a, nil
+}
+
+// ServeHTTP implements http.Handler
+func (a *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+// ConnInfo describes a connection
+type ConnInfo struct {
+	Peer       peer.ID      `json:"peer"`
+	LocalAddr  string       `json:"local_addr"`
+	RemoteAddr string       `json:"remote_addr"`
+	Transport  string       `json:"transport"`
+	Direction  string       `json:"direction"`
+	Security   string       `json:"security,omitempty"`
+	Muxer      string       `json:"muxer,omitempty"`
+	Opened     *time.Time   `json:"opened,omitempty"`
+	Age        string       `json:"age,omitempty"`
+	Streams    []StreamInfo `json:"streams"`
+}
+
+// StreamInfo describes a stream
+type StreamInfo struct {
+	Protocol     string     `json:"protocol"`
+	Direction    string     `json:"direction"`
+	BytesRead    uint64     `json:"bytes_read"`
+	BytesWritten uint64     `json:"bytes_written"`
+	Opened       *time.Time `json:"opened,omitempty"`
+	Age          string     `json:"age,omitempty"`
+}
+
+func (a *Handler) serveConns(w http.ResponseWriter, r *http.Request) {
+	conns := a.host.Network().Conns()
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, connInfo(c))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Peer != infos[j].Peer {
+			return infos[i].Peer < infos[j].Peer
+		}
+		return infos[i].RemoteAddr < infos[j].RemoteAddr
+	})
+	writeJSON(w, infos)
+}
+
+func connInfo(c network.Conn) ConnInfo {
+	info := ConnInfo{
+		Peer:       c.RemotePeer(),
+		LocalAddr:  c.LocalMultiaddr().String(),
+		RemoteAddr: c.RemoteMultiaddr().String(),
+		Transport:  metrics.TransportName(c.RemoteMultiaddr()),
+		Direction:  metrics.DirectionName(c.Stat().Direction),
+		Streams:    []StreamInfo{},
+	}
+	if sc, ok := c.(*swarm.Conn); ok {
+		info.Security = sc.Security()
+		info.Muxer = sc.Muxer()
+		info.Opened, info.Age = since(sc.Opened())
+	}
+	for _, s := range c.GetStreams() {
+		sinfo := StreamInfo{
+			Protocol:  string(s.Protocol()),
+			Direction: metrics.DirectionName(s.Stat().Direction),
+		}
+		if ss, ok := s.(*swarm.Stream); ok {
+			sinfo.BytesRead = ss.BytesRead()
+			sinfo.BytesWritten = ss.BytesWritten()
+			sinfo.Opened, sinfo.Age = since(ss.Opened())
+		}
+		info.Streams = append(info.Streams, sinfo)
+	}
+	return info
+}
+
+// PeerInfo describes the peerstore entry of a peer
+type PeerInfo struct {
+	ID              peer.ID  `json:"id"`
+	Connectedness   string   `json:"connectedness"`
+	Addrs           []string `json:"addrs"`
+	Protocols       []string `json:"protocols"`
+	AgentVersion    string   `json:"agent_version,omitempty"`
+	ProtocolVersion string   `json:"protocol_version,omitempty"`
+	Latency         string   `json:"latency,omitempty"`
+}
+
+func (a *Handler) servePeer(w http.ResponseWriter, r *http.Request) {
+	p, err := peer.Decode(strings.TrimPrefix(r.URL.Path, "/peers/"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid peer id")
+		return
+	}
+	ps := a.host.Peerstore()
+	if !knownPeer(ps.Peers(), p) {
+		writeError(w, http.StatusNotFound, "peer not found")
+		return
+	}
+	protos, err := ps.GetProtocols(p)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	info := PeerInfo{
+		ID:            p,
+		Connectedness: connectednessName(a.host.Network().Connectedness(p)),
+		Addrs:         addrStrings(ps.Addrs(p)),
+		Protocols:     protos,
+	}
+	if info.Protocols == nil {
+		info.Protocols = []string{}
+	}
+	if v, err := ps.Get(p, "AgentVersion"); err == nil {
+		info.AgentVersion, _ = v.(string)
+	}
+	if v, err := ps.Get(p, "ProtocolVersion"); err == nil {
+		info.ProtocolVersion, _ = v.(string)
+	}
+	if l := ps.LatencyEWMA(p); l > 0 {
+		info.Latency = l.String()
+	}
+	writeJSON(w, info)
+}
+
+// TopicInfo describes a pubsub topic we joined
+type TopicInfo struct {
+	Topic string    `json:"topic"`
+	Peers []peer.ID `json:"peers"`
+	Mesh  []peer.ID `json:"mesh"`
+}
+
+// PubSubInfo describes the pubsub state
+type PubSubInfo struct {
+	Topics []TopicInfo          `json:"topics"`
+	Fanout map[string][]peer.ID `json:"fanout"`
+}
+
+func (a *Handler) servePubSub(w http.ResponseWriter, r *http.Request) {
+	if a.pubsub == nil {
+		writeError(w, http.StatusNotFound, "pubsub is not enabled")
+		return
+	}
+	state := a.pubsub.RouterState()
+	info := PubSubInfo{
+		Topics: []TopicInfo{},
+		Fanout: state.Fanout,
+	}
+	if info.Fanout == nil {
+		info.Fanout = map[string][]peer.ID{}
+	}
+	topics := a.pubsub.GetTopics()
+	sort.Strings(topics)
+	for _, topic := range topics {
+		info.Topics = append(info.Topics, TopicInfo{
+			Topic: topic,
+			Peers: sortedPeers(a.pubsub.ListPeers(topic)),
+			Mesh:  sortedPeers(state.Mesh[topic]),
+		})
+	}
+	writeJSON(w, info)
+}
+
+// RoutingInfo describes the routing table
+type RoutingInfo struct {
+	Peers []peer.ID `json:"peers"`
+}
+
+func (a *Handler) serveRouting(w http.ResponseWriter, r *http.Request) {
+	if a.routing == nil {
+		writeError(w, http.StatusNotFound, "no routing table")
+		return
+	}
+	writeJSON(w, RoutingInfo{Peers: sortedPeers(a.routing.ListPeers())})
+}
+
+// MappingInfo describes a NAT port mapping
+type MappingInfo struct {
+	Protocol     string `json:"protocol"`
+	InternalPort int    `json:"internal_port"`
+	ExternalPort int    `json:"external_port"`
+	ExternalAddr string `json:"external_addr,omitempty"`
+}
+
+// NATInfo describes the NAT device, if one was found
+type NATInfo struct {
+	Enabled  bool          `json:"enabled"`
+	Found    bool          `json:"found"`
+	Mappings []MappingInfo `json:"mappings"`
+}
+
+func (a *Handler) serveNAT(w http.ResponseWriter, r *http.Request) {
+	info := NATInfo{Mappings: []MappingInfo{}}
+	var nmgr bhost.NATManager
+	if h, ok := a.host.(interface{ NATManager() bhost.NATManager }); ok {
+		nmgr = h.NATManager()
+	}
+	if nmgr != nil {
+		info.Enabled = true
+		if nat := nmgr.NAT(); nat != nil {
+			info.Found = true
+			for _, m := range nat.Mappings() {
+				mi := MappingInfo{
+					Protocol:     m.Protocol(),
+					InternalPort: m.InternalPort(),
+					ExternalPort: m.ExternalPort(),
+				}
+				if addr, err := m.ExternalAddr(); err == nil {
+					mi.ExternalAddr = addr.String()
+				}
+				info.Mappings = append(info.Mappings, mi)
+			}
+		}
+	}
+	writeJSON(w, info)
+}
+
+// RelayInfo describes the relays we use and the hops we relay
+type RelayInfo struct {
+	Relays   []peer.ID         `json:"relays"`
+	Hops     *circuit.HopStats `json:"hops,omitempty"`
+	Circuits []string          `json:"circuit_addrs"`
+}
+
+func (a *Handler) serveRelay(w http.ResponseWriter, r *http.Request) {
+	info := RelayInfo{
+		Relays:   []peer.ID{},
+		Circuits: []string{},
+	}
+	if a.autorelay != nil {
+		info.Relays = sortedPeers(a.autorelay.Relays())
+	}
+	if a.relay != nil {
+		st := a.relay.HopStats()
+		info.Hops = &st
+	}
+	for _, addr := range a.host.Addrs() {
+		if _, err := addr.ValueForProtocol(ma.P_CIRCUIT); err == nil {
+			info.Circuits = append(info.Circuits, addr.String())
+		}
+	}
+	writeJSON(w, info)
+}
+
+func since(t time.Time) (*time.Time, string) {
+	if t.IsZero() {
+		return nil, ""
+	}
+	return &t, time.Since(t).Round(time.Millisecond).String()
+}
+
+func connectednessName(c network.Connectedness) string {
+	switch c {
+	case network.Connected:
+		return "connected"
+	case network.CanConnect:
+		return "can_connect"
+	case network.CannotConnect:
+		return "cannot_connect"
+	default:
+		return "not_connected"
+	}
+}
+
+func addrStrings(addrs []ma.Multiaddr) []string {
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, a.String())
+	}
+	sort.Strings(out)
+	return out
+}
+
+func knownPeer(peers []peer.ID, p peer.ID) bool {
+	for _, known := range peers {
+		if known == p {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedPeers(peers []peer.ID) []peer.ID {
+	out := append([]peer.ID{}, peers...)
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+	return out
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{msg})
+}
@@ -0,0 +1,143 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	bhost "github.com/RTradeLtd/libp2px/p2p/host/basic"
+	"github.com/RTradeLtd/libp2px/pkg/admin"
+	"github.com/RTradeLtd/libp2px/pkg/pubsub"
+	swarmt "github.com/RTradeLtd/libp2px/pkg/swarm/testing"
+	"github.com/RTradeLtd/libp2px/pkg/transports/secio"
+	"go.uber.org/zap/zaptest"
+)
+
+func get(t *testing.T, h http.Handler, path string, v interface{}) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if v != nil && rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newHost := func() *bhost.BasicHost {
+		s, _ := swarmt.GenSwarm(t, ctx)
+		h, err := bhost.NewHost(ctx, s, &bhost.HostOpts{}, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	h1 := newHost()
+	defer h1.Close()
+	h2 := newHost()
+	defer h2.Close()
+	h2.SetStreamHandler("/echo", func(s network.Stream) {
+		io.Copy(s, s)
+		s.Close()
+	})
+
+	ps1, err := pubsub.NewGossipSub(ctx, h1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps2, err := pubsub.NewGossipSub(ctx, h2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ps := range []*pubsub.PubSub{ps1, ps2} {
+		if _, err := ps.Subscribe("topic"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := h1.Connect(ctx, peer.AddrInfo{ID: h2.ID(), Addrs: h2.Addrs()}); err != nil {
+		t.Fatal(err)
+	}
+	s, err := h1.NewStream(ctx, h2.ID(), "/echo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(s, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := admin.NewHandler(h1, admin.WithPubSub(ps1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var conns []admin.ConnInfo
+	if code := get(t, a, "/conns", &conns); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if len(conns) != 1 {
+		t.Fatalf("expected a single connection, got %d", len(conns))
+	}
+	c := conns[0]
+	if c.Peer != h2.ID() || c.Transport != "tcp" || c.Direction != "outbound" || c.Security != secio.ID || c.Muxer != "/yamux/1.0.0" || c.Opened == nil {
+		t.Fatalf("unexpected connection %+v", c)
+	}
+	var echo *admin.StreamInfo
+	for i, st := range c.Streams {
+		if st.Protocol == "/echo" {
+			echo = &c.Streams[i]
+		}
+	}
+	// the counts include the protocol negotiation
+	if echo == nil || echo.BytesWritten < 4 || echo.BytesRead < 4 || echo.Direction != "outbound" {
+		t.Fatalf("unexpected streams %+v", c.Streams)
+	}
+
+	var info admin.PeerInfo
+	if code := get(t, a, "/peers/"+h2.ID().Pretty(), &info); code != http.StatusOK {
+		t.Fatalf("unexpected status %d", code)
+	}
+	if info.ID != h2.ID() || info.Connectedness != "connected" || len(info.Addrs) == 0 {
+		t.Fatalf("unexpected peer %+v", info)
+	}
+	if code := get(t, a, "/peers/nope", nil); code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid peer id to be refused, got %d", code)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var pi admin.PubSubInfo
+		if code := get(t, a, "/pubsub", &pi); code != http.StatusOK {
+			t.Fatalf("unexpected status %d", code)
+		}
+		if len(pi.Topics) == 1 && len(pi.Topics[0].Mesh) == 1 && pi.Topics[0].Mesh[0] == h2.ID() {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("h2 never joined the mesh: %+v", pi)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if code := get(t, a, "/routing", nil); code != http.StatusNotFound {
+		t.Fatalf("expected no routing table, got %d", code)
+	}
+	var nat admin.NATInfo
+	if code := get(t, a, "/nat", &nat); code != http.StatusOK || nat.Enabled {
+		t.Fatalf("unexpected nat state %d %+v", code, nat)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/RTradeLtd/libp2px-core/peerstore"
 	"github.com/RTradeLtd/libp2px-core/protocol"
 
+	"github.com/RTradeLtd/libp2px/p2p/host/middleware"
 	"github.com/RTradeLtd/libp2px/pkg/eventbus"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -27,6 +28,7 @@ type BlankHost struct {
 	emitters struct {
 		evtLocalProtocolsUpdated event.Emitter
 	}
+	mw middleware.Chain
 }
 
 func NewBlankHost(n network.Network) *BlankHost {
@@ -41,12 +43,18 @@ func NewBlankHost(n network.Network) *BlankHost {
 	if bh.emitters.evtLocalProtocolsUpdated, err = bh.eventbus.Emitter(&event.EvtLocalProtocolsUpdated{}); err != nil {
 		return nil
 	}
+	if es, ok := n.(interface{ SetEventBus(event.Bus) error }); ok {
+		if err := es.SetEventBus(bh.eventbus); err != nil {
+			return nil
+		}
+	}
 
 	n.SetStreamHandler(bh.newStreamHandler)
 	return bh
 }
 
 var _ host.Host = (*BlankHost)(nil)
+var _ middleware.Host = (*BlankHost)(nil)
 
 func (bh *BlankHost) Addrs() []ma.Multiaddr {
 	addrs, err := bh.n.InterfaceListenAddresses()
@@ -103,7 +111,17 @@ func (bh *BlankHost) NewStream(ctx context.Context, p peer.ID, protos ...protoco
 	s.SetProtocol(selpid)
 	bh.Peerstore().AddProtocols(p, selected)
 
-	return s, nil
+	return bh.mw.Outbound(s)
+}
+
+// Use registers stream middlewares applying to every protocol
+func (bh *BlankHost) Use(mws ...middleware.Middleware) {
+	bh.mw.Use(mws...)
+}
+
+// UseFor registers stream middlewares applying to pid only
+func (bh *BlankHost) UseFor(pid protocol.ID, mws ...middleware.Middleware) {
+	bh.mw.UseFor(pid, mws...)
 }
 
 func (bh *BlankHost) RemoveStreamHandler(pid protocol.ID) {
@@ -114,6 +132,7 @@ func (bh *BlankHost) RemoveStreamHandler(pid protocol.ID) {
 }
 
 func (bh *BlankHost) SetStreamHandler(pid protocol.ID, handler network.StreamHandler) {
+	handler = bh.mw.Wrap(handler)
 	bh.Mux().AddHandler(string(pid), func(p string, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		is.SetProtocol(protocol.ID(p))
@@ -126,6 +145,7 @@ func (bh *BlankHost) SetStreamHandler(pid protocol.ID, handler network.StreamHan
 }
 
 func (bh *BlankHost) SetStreamHandlerMatch(pid protocol.ID, m func(string) bool, handler network.StreamHandler) {
+	handler = bh.mw.Wrap(handler)
 	bh.Mux().AddHandlerWithFunc(string(pid), m, func(p string, rwc io.ReadWriteCloser) error {
 		is := rwc.(network.Stream)
 		is.SetProtocol(protocol.ID(p))
@@ -0,0 +1,155 @@
+package connmgr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	tu "github.com/RTradeLtd/libp2px-core/test"
+	"go.uber.org/zap/zaptest"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+type tconn struct {
+	network.Conn
+
+	peer   peer.ID
+	closed bool
+}
+
+func (c *tconn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (c *tconn) RemotePeer() peer.ID {
+	return c.peer
+}
+
+func (c *tconn) RemoteMultiaddr() ma.Multiaddr {
+	addr, err := ma.NewMultiaddr("/ip4/127.0.0.1/udp/1234")
+	if err != nil {
+		panic("cannot create multiaddr")
+	}
+	return addr
+}
+
+func randConn(t testing.TB, not network.Notifiee) *tconn {
+	pid, err := tu.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &tconn{peer: pid}
+	not.Connected(nil, c)
+	return c
+}
+
+func newConnManager(t *testing.T, low, hi int, grace time.Duration, opts ...Option) *BasicConnMgr {
+	cm, err := NewConnManager(context.Background(), zaptest.NewLogger(t), low, hi, grace, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cm
+}
+
+func TestTrimRespectsTagsAndProtection(t *testing.T) {
+	// stay at the high watermark so only the explicit trim below runs
+	cm := newConnManager(t, 10, 30, 0)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var conns []*tconn
+	for i := 0; i < 30; i++ {
+		c := randConn(t, not)
+		cm.TagPeer(c.peer, "value", i)
+		conns = append(conns, c)
+	}
+	// protect the least valuable peer
+	cm.Protect(conns[0].peer, "test")
+	if !cm.IsProtected(conns[0].peer, "") || !cm.IsProtected(conns[0].peer, "test") {
+		t.Fatal("peer should be protected")
+	}
+	if cm.IsProtected(conns[0].peer, "other") || cm.IsProtected(conns[1].peer, "") {
+		t.Fatal("peer should not be protected")
+	}
+
+	cm.TrimOpenConns(context.Background())
+
+	if conns[0].closed {
+		t.Fatal("protected conn was closed")
+	}
+	// 29 unprotected conns are trimmed down to the low watermark
+	for i, c := range conns[1:20] {
+		if !c.closed {
+			t.Fatalf("low value conn %d was not closed", i+1)
+		}
+	}
+	for i, c := range conns[20:] {
+		if c.closed {
+			t.Fatalf("high value conn %d was closed", i+20)
+		}
+	}
+}
+
+func TestTrimGracePeriod(t *testing.T) {
+	cm := newConnManager(t, 10, 30, time.Hour)
+	defer cm.Close()
+	not := cm.Notifee()
+
+	var conns []*tconn
+	for i := 0; i < 30; i++ {
+		conns = append(conns, randConn(t, not))
+	}
+
+	cm.TrimOpenConns(context.Background())
+
+	for _, c := range conns {
+		if c.closed {
+			t.Fatal("conn within the grace period was closed")
+		}
+	}
+}
+
+func TestDecayingTags(t *testing.T) {
+	cm := newConnManager(t, 10, 20, 0, WithDecayer(&DecayerCfg{Resolution: 50 * time.Millisecond}))
+	defer cm.Close()
+	c := randConn(t, cm.Notifee())
+
+	tag, err := cm.RegisterDecayingTag("decay", 50*time.Millisecond, DecayFixed(1), BumpSumUnbounded())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cm.RegisterDecayingTag("decay", time.Second, DecayNone(), BumpOverwrite()); err == nil {
+		t.Fatal("expected duplicate tag registration to fail")
+	}
+	if err := tag.Bump(c.peer, 3); err != nil {
+		t.Fatal(err)
+	}
+	if v := cm.GetTagInfo(c.peer).Tags["decay"]; v != 3 {
+		t.Fatalf("expected tag value 3, got %d", v)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := cm.GetTagInfo(c.peer).Tags["decay"]; !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("decaying tag was not removed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if v := cm.GetTagInfo(c.peer).Value; v != 0 {
+		t.Fatalf("expected peer value 0, got %d", v)
+	}
+
+	if err := tag.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tag.Bump(c.peer, 1); err == nil {
+		t.Fatal("expected bump on closed tag to fail")
+	}
+}
@@ -0,0 +1,345 @@
+package connmgr
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"go.uber.org/zap"
+)
+
+// DecayFn applies a decay to the peer's score. The implementation must call
+// DecayFn at the interval supplied when registering the tag.
+//
+// It receives a copy of the decaying value, and returns the score after
+// applying the decay, as well as a flag to signal if the tag should be erased.
+type DecayFn func(value DecayingValue) (after int, rm bool)
+
+// BumpFn applies a delta onto an existing score, and returns the new score.
+//
+// Non-trivial bump functions include exponential boosting, moving averages,
+// ceilings, etc.
+type BumpFn func(value DecayingValue, delta int) (after int)
+
+// DecayingTag represents a decaying tag. The tag is a long-lived general
+// object, used to operate on tag values for peers.
+type DecayingTag interface {
+	// Name returns the name of the tag.
+	Name() string
+
+	// Interval is the effective interval at which this tag will tick. Upon
+	// registration, the desired interval may be overwritten depending on the
+	// decayer's resolution, and this method allows you to obtain the effective
+	// interval.
+	Interval() time.Duration
+
+	// Bump applies a delta to a tag value, calling its bump function.
+	Bump(peer peer.ID, delta int) error
+
+	// Remove removes a decaying tag from a peer.
+	Remove(peer peer.ID) error
+
+	// Close closes a decaying tag. The Decayer will stop tracking this tag,
+	// and the state of all peers in the Connection Manager holding this tag
+	// will be updated.
+	Close() error
+}
+
+// DecayingValue represents a value for a decaying tag.
+type DecayingValue struct {
+	// Tag points to the tag this value belongs to.
+	Tag DecayingTag
+
+	// Peer is the peer ID to whom this value is associated.
+	Peer peer.ID
+
+	// Added is the timestamp when this value was added for the first time for
+	// a tag and a peer.
+	Added time.Time
+
+	// LastVisit is the timestamp of the last visit.
+	LastVisit time.Time
+
+	// Value is the current value of the tag.
+	Value int
+}
+
+// DecayerCfg is the configuration object for the Decayer.
+type DecayerCfg struct {
+	Resolution time.Duration
+}
+
+// DefaultDecayerConfig returns the default configuration of the decayer
+func DefaultDecayerConfig() *DecayerCfg {
+	return &DecayerCfg{Resolution: time.Minute}
+}
+
+// decayer tracks the decaying tags of a BasicConnMgr and periodically applies
+// their decay functions to the tagged peers.
+type decayer struct {
+	cm  *BasicConnMgr
+	cfg *DecayerCfg
+
+	mu        sync.Mutex
+	knownTags map[string]*decayingTag
+}
+
+func newDecayer(cm *BasicConnMgr, cfg *DecayerCfg) *decayer {
+	return &decayer{
+		cm:        cm,
+		cfg:       cfg,
+		knownTags: make(map[string]*decayingTag),
+	}
+}
+
+// RegisterDecayingTag creates and registers a new decaying tag. The tag value
+// of every peer holding it is decayed once per interval, which is rounded up
+// to a multiple of the decayer resolution.
+func (cm *BasicConnMgr) RegisterDecayingTag(name string, interval time.Duration, decayFn DecayFn, bumpFn BumpFn) (DecayingTag, error) {
+	d := cm.decayer
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.knownTags[name]; ok {
+		return nil, fmt.Errorf("decaying tag with name %s already exists", name)
+	}
+
+	if interval < d.cfg.Resolution {
+		cm.logger.Warn("decay interval for tag was lower than resolution; overriding",
+			zap.String("tag", name),
+			zap.Duration("interval", interval),
+			zap.Duration("resolution", d.cfg.Resolution),
+		)
+		interval = d.cfg.Resolution
+	}
+
+	if interval%d.cfg.Resolution != 0 {
+		interval = time.Duration(math.Ceil(float64(interval)/float64(d.cfg.Resolution))) * d.cfg.Resolution
+	}
+
+	tag := &decayingTag{
+		cm:       cm,
+		name:     name,
+		interval: interval,
+		nextTick: time.Now().Add(interval),
+		decayFn:  decayFn,
+		bumpFn:   bumpFn,
+	}
+	d.knownTags[name] = tag
+	return tag, nil
+}
+
+// process is the decayer's main loop, applying the decay functions of all due
+// tags every resolution tick
+func (d *decayer) process() {
+	defer d.cm.wg.Done()
+	ticker := time.NewTicker(d.cfg.Resolution)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			d.mu.Lock()
+			due := make(map[*decayingTag]struct{})
+			for _, tag := range d.knownTags {
+				if tag.nextTick.After(now) {
+					continue
+				}
+				tag.nextTick = tag.nextTick.Add(tag.interval)
+				due[tag] = struct{}{}
+			}
+			d.mu.Unlock()
+
+			if len(due) == 0 {
+				continue
+			}
+			d.decay(due, now)
+		case <-d.cm.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *decayer) decay(due map[*decayingTag]struct{}, now time.Time) {
+	for _, s := range d.cm.segments {
+		s.Lock()
+		for _, p := range s.peers {
+			for tag, v := range p.decaying {
+				if _, ok := due[tag]; !ok {
+					continue
+				}
+				after, rm := tag.decayFn(*v)
+				if rm {
+					p.value -= v.Value
+					delete(p.decaying, tag)
+					continue
+				}
+				p.value += after - v.Value
+				v.Value = after
+				v.LastVisit = now
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// decayingTag is the default implementation of DecayingTag
+type decayingTag struct {
+	cm       *BasicConnMgr
+	name     string
+	interval time.Duration
+	nextTick time.Time
+	decayFn  DecayFn
+	bumpFn   BumpFn
+
+	closed int32
+}
+
+var _ DecayingTag = (*decayingTag)(nil)
+
+// Name returns the name of the tag
+func (t *decayingTag) Name() string {
+	return t.name
+}
+
+// Interval returns the effective decay interval of the tag
+func (t *decayingTag) Interval() time.Duration {
+	return t.interval
+}
+
+// Bump applies delta to the value of the tag for the given peer
+func (t *decayingTag) Bump(p peer.ID, delta int) error {
+	if atomic.LoadInt32(&t.closed) == 1 {
+		return fmt.Errorf("decaying tag %s had been closed; no further bumps are accepted", t.name)
+	}
+
+	s := t.cm.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+
+	pi := s.tagInfoFor(p)
+	now := time.Now()
+	v, ok := pi.decaying[t]
+	if !ok {
+		v = &DecayingValue{
+			Tag:       t,
+			Peer:      p,
+			Added:     now,
+			LastVisit: now,
+		}
+		pi.decaying[t] = v
+	}
+
+	prev := v.Value
+	v.Value = t.bumpFn(*v, delta)
+	v.LastVisit = now
+	pi.value += v.Value - prev
+	return nil
+}
+
+// Remove removes the tag from the given peer
+func (t *decayingTag) Remove(p peer.ID) error {
+	if atomic.LoadInt32(&t.closed) == 1 {
+		return fmt.Errorf("decaying tag %s had been closed; no further removals are accepted", t.name)
+	}
+
+	s := t.cm.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+
+	if pi, ok := s.peers[p]; ok {
+		if v, ok := pi.decaying[t]; ok {
+			pi.value -= v.Value
+			delete(pi.decaying, t)
+		}
+	}
+	return nil
+}
+
+// Close unregisters the tag and removes it from every peer holding it
+func (t *decayingTag) Close() error {
+	if !atomic.CompareAndSwapInt32(&t.closed, 0, 1) {
+		return fmt.Errorf("decaying tag %s had already been closed", t.name)
+	}
+
+	d := t.cm.decayer
+	d.mu.Lock()
+	delete(d.knownTags, t.name)
+	d.mu.Unlock()
+
+	for _, s := range t.cm.segments {
+		s.Lock()
+		for _, p := range s.peers {
+			if v, ok := p.decaying[t]; ok {
+				p.value -= v.Value
+				delete(p.decaying, t)
+			}
+		}
+		s.Unlock()
+	}
+	return nil
+}
+
+// DecayNone applies no decay.
+func DecayNone() DecayFn {
+	return func(value DecayingValue) (_ int, rm bool) {
+		return value.Value, false
+	}
+}
+
+// DecayFixed subtracts from by the provided minuend, and deletes the tag when
+// first reaching 0 or negative.
+func DecayFixed(minuend int) DecayFn {
+	return func(value DecayingValue) (_ int, rm bool) {
+		v := value.Value - minuend
+		return v, v <= 0
+	}
+}
+
+// DecayLinear applies a fractional coefficient to the value of the current tag,
+// rounding down via math.Floor. It erases the tag when the result is zero.
+func DecayLinear(coef float64) DecayFn {
+	return func(value DecayingValue) (after int, rm bool) {
+		v := math.Floor(float64(value.Value) * coef)
+		return int(v), v <= 0
+	}
+}
+
+// DecayExpireWhenInactive expires a tag after a certain period of no bumps.
+func DecayExpireWhenInactive(after time.Duration) DecayFn {
+	return func(value DecayingValue) (_ int, rm bool) {
+		rm = time.Since(value.LastVisit) >= after
+		return 0, rm
+	}
+}
+
+// BumpSumUnbounded adds the incoming value to the peer's score.
+func BumpSumUnbounded() BumpFn {
+	return func(value DecayingValue, delta int) (after int) {
+		return value.Value + delta
+	}
+}
+
+// BumpSumBounded keeps summing the incoming score, keeping it within a
+// [min, max] range.
+func BumpSumBounded(min, max int) BumpFn {
+	return func(value DecayingValue, delta int) (after int) {
+		v := value.Value + delta
+		if v >= max {
+			return max
+		} else if v <= min {
+			return min
+		}
+		return v
+	}
+}
+
+// BumpOverwrite replaces the current value of the tag with the incoming one.
+func BumpOverwrite() BumpFn {
+	return func(value DecayingValue, delta int) (after int) {
+		return delta
+	}
+}
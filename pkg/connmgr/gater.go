@@ -0,0 +1,94 @@
+package connmgr
+
+import (
+	"fmt"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/transport"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ConnectionGater can be implemented by a type that supports active
+// inbound or outbound connection gating.
+//
+// ConnectionGaters are consulted by the swarm and the upgrader at five
+// points in the lifecycle of a connection, allowing a connection to be
+// refused as early as possible:
+//
+// 1. InterceptPeerDial is called before we dial a peer, and is supplied
+//    with the peer ID.
+// 2. InterceptAddrDial is called for every address of a peer we are about
+//    to dial, before the dial is attempted.
+// 3. InterceptAccept is called as soon as a transport listener accepts an
+//    inbound connection, before any upgrade takes place.
+// 4. InterceptSecured is called for both inbound and outbound connections,
+//    after the security handshake, once the remote peer ID is authenticated.
+// 5. InterceptUpgraded is called once the stream multiplexer has been
+//    negotiated, right before the connection is added to the swarm.
+//
+// Returning a nil error allows the connection to proceed, while any other
+// error refuses it, with the error serving as the reason. Refusals are
+// surfaced to callers as a *GateError wrapping that reason.
+type ConnectionGater interface {
+	// InterceptPeerDial tests whether we're permitted to dial the specified peer.
+	InterceptPeerDial(p peer.ID) error
+
+	// InterceptAddrDial tests whether we're permitted to dial the specified
+	// multiaddr of the given peer.
+	InterceptAddrDial(p peer.ID, addr ma.Multiaddr) error
+
+	// InterceptAccept tests whether an incipient inbound connection is allowed.
+	InterceptAccept(addrs network.ConnMultiaddrs) error
+
+	// InterceptSecured tests whether a given connection, now authenticated,
+	// is allowed.
+	InterceptSecured(dir network.Direction, p peer.ID, addrs network.ConnMultiaddrs) error
+
+	// InterceptUpgraded tests whether a fully capable connection is allowed.
+	InterceptUpgraded(conn transport.CapableConn) error
+}
+
+// GatePoint identifies at which point of the connection lifecycle a
+// ConnectionGater refused a connection.
+type GatePoint string
+
+const (
+	// GatePeerDial is the point at which peer dials are intercepted
+	GatePeerDial GatePoint = "peer dial"
+	// GateAddrDial is the point at which address dials are intercepted
+	GateAddrDial GatePoint = "addr dial"
+	// GateAccept is the point at which inbound connections are intercepted
+	GateAccept GatePoint = "accept"
+	// GateSecured is the point at which authenticated connections are intercepted
+	GateSecured GatePoint = "secured"
+	// GateUpgraded is the point at which upgraded connections are intercepted
+	GateUpgraded GatePoint = "upgraded"
+)
+
+// GateError is returned when a ConnectionGater refuses a connection
+type GateError struct {
+	Point  GatePoint
+	Reason error
+}
+
+func (e *GateError) Error() string {
+	return fmt.Sprintf("connection gated at %s: %s", e.Point, e.Reason)
+}
+
+// Unwrap returns the reason given by the gater
+func (e *GateError) Unwrap() error {
+	return e.Reason
+}
+
+var _ error = (*GateError)(nil)
+
+// NewGateError returns a *GateError for the given point, or nil if the
+// reason is nil, so the result of an intercept can be passed straight in.
+func NewGateError(point GatePoint, reason error) error {
+	if reason == nil {
+		return nil
+	}
+	return &GateError{Point: point, Reason: reason}
+}
@@ -0,0 +1,76 @@
+package eventbus
+
+import (
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px/pkg/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// This file contains event types emitted by libp2px components that are not
+// (yet) part of libp2px-core.
+
+// EvtLocalAddressesUpdated is emitted when the set of addresses the local host
+// advertises changes.
+type EvtLocalAddressesUpdated struct {
+	// Added enumerates the addresses that are now advertised.
+	Added []ma.Multiaddr
+	// Removed enumerates the addresses that are no longer advertised.
+	Removed []ma.Multiaddr
+	// SignedPeerRecord is the signed record of the updated address set, or
+	// nil if the host was unable to sign it.
+	SignedPeerRecord *record.Envelope
+}
+
+// EvtPeerGoingAway is emitted when a connected peer announces it is draining
+// its host, and will close its connections once its active streams finish.
+type EvtPeerGoingAway struct {
+	// Peer is the peer going away.
+	Peer peer.ID
+}
+
+// EvtPeerConnectednessChanged is emitted when the swarm opens its first
+// connection to a peer, or closes its last one.
+type EvtPeerConnectednessChanged struct {
+	// Peer is the peer whose connectedness changed.
+	Peer peer.ID
+	// Connectedness is the new connectedness state.
+	Connectedness network.Connectedness
+}
+
+// EvtConnOpened is emitted when a connection is added to the swarm, after
+// the network notifiees were told about it.
+type EvtConnOpened struct {
+	// Conn is the new connection.
+	Conn network.Conn
+	// Transport names the transport of the connection, like "tcp", "udp/quic"
+	// or "p2p-circuit".
+	Transport string
+	// Direction tells whether we dialed the connection or accepted it.
+	Direction network.Direction
+}
+
+// CloseReason tells why a connection was closed.
+type CloseReason string
+
+const (
+	// CloseLocal means the connection was closed on our side, by the host,
+	// the connection manager or a user of the connection.
+	CloseLocal CloseReason = "local"
+	// CloseRemote means the remote peer closed the connection, or it failed.
+	CloseRemote CloseReason = "remote"
+	// CloseSwarm means the connection was closed by the swarm shutting down.
+	CloseSwarm CloseReason = "swarm closed"
+)
+
+// EvtConnClosed is emitted when a connection is removed from the swarm.
+type EvtConnClosed struct {
+	// Conn is the closed connection.
+	Conn network.Conn
+	// Reason tells why the connection was closed.
+	Reason CloseReason
+	// Err is the error the connection failed with, if the reason is
+	// CloseRemote and the muxer reported one.
+	Err error
+}
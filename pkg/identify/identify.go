@@ -0,0 +1,436 @@
+package identify
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	ic "github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/event"
+	"github.com/RTradeLtd/libp2px-core/helpers"
+	"github.com/RTradeLtd/libp2px-core/host"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/peerstore"
+	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	pb "github.com/RTradeLtd/libp2px/pkg/identify/pb"
+	"go.uber.org/zap"
+
+	ggio "github.com/gogo/protobuf/io"
+	ma "github.com/multiformats/go-multiaddr"
+	msmux "github.com/multiformats/go-multistream"
+)
+
+// ID is the protocol.ID of the identify service.
+const ID = "/ipfs/id/1.0.0"
+
+// LibP2PVersion holds the current protocol version for a client running this code
+const LibP2PVersion = "ipfs/0.1.0"
+
+// DefaultUserAgent is the user agent sent when none has been configured
+const DefaultUserAgent = "github.com/RTradeLtd/libp2px"
+
+// IDService is a structure that implements ProtocolIdentify.
+// It is a trivial service that gives the other peer some
+// useful information about the local peer. A sort of hello.
+//
+// The IDService sends our protocol version, public key, user agent, listen
+// addresses, the address we observe the remote peer on and the protocols we
+// support. Everything except the protocol version and public key can be
+// withheld using the Disclose* options.
+type IDService struct {
+	Host host.Host
+	cfg  config
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// connections undergoing identification
+	// for wait purposes
+	currid map[network.Conn]chan struct{}
+	currmu sync.Mutex
+
+	// our own addresses as observed by remote peers
+	observedAddrs *ObservedAddrSet
+
+	// per peer push state, for rate limiting pushes in both directions
+	pushmu   sync.Mutex
+	pushers  map[peer.ID]*peerPusher
+	limiters map[peer.ID]*pushLimiter
+
+	emitters struct {
+		evtPeerIdentificationCompleted event.Emitter
+		evtPeerIdentificationFailed    event.Emitter
+		evtPeerProtocolsUpdated        event.Emitter
+	}
+
+	logger *zap.Logger
+}
+
+// NewIDService constructs a new *IDService and activates it by
+// attaching its stream handler to the given host.Host.
+func NewIDService(ctx context.Context, h host.Host, logger *zap.Logger, opts ...Option) (*IDService, error) {
+	cfg := config{
+		userAgent:    DefaultUserAgent,
+		pushInterval: DefaultPushInterval,
+		pushBurst:    DefaultPushBurst,
+	}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	ids := &IDService{
+		Host:          h,
+		cfg:           cfg,
+		currid:        make(map[network.Conn]chan struct{}),
+		observedAddrs: NewObservedAddrSet(),
+		pushers:       make(map[peer.ID]*peerPusher),
+		limiters:      make(map[peer.ID]*pushLimiter),
+		logger:        logger.Named("identify"),
+	}
+	ids.ctx, ids.cancel = context.WithCancel(ctx)
+
+	var err error
+	ids.emitters.evtPeerIdentificationCompleted, err = h.EventBus().Emitter(&event.EvtPeerIdentificationCompleted{})
+	if err != nil {
+		return nil, err
+	}
+	ids.emitters.evtPeerIdentificationFailed, err = h.EventBus().Emitter(&event.EvtPeerIdentificationFailed{})
+	if err != nil {
+		ids.emitters.evtPeerIdentificationCompleted.Close()
+		return nil, err
+	}
+	ids.emitters.evtPeerProtocolsUpdated, err = h.EventBus().Emitter(&event.EvtPeerProtocolsUpdated{})
+	if err != nil {
+		ids.emitters.evtPeerIdentificationCompleted.Close()
+		ids.emitters.evtPeerIdentificationFailed.Close()
+		return nil, err
+	}
+
+	// local changes are pushed to our peers as deltas
+	sub, err := h.EventBus().Subscribe([]interface{}{
+		&event.EvtLocalProtocolsUpdated{},
+		&eventbus.EvtLocalAddressesUpdated{},
+	})
+	if err != nil {
+		ids.emitters.evtPeerIdentificationCompleted.Close()
+		ids.emitters.evtPeerIdentificationFailed.Close()
+		ids.emitters.evtPeerProtocolsUpdated.Close()
+		return nil, err
+	}
+	go ids.handleEvents(sub)
+
+	h.SetStreamHandler(ID, ids.requestHandler)
+	h.SetStreamHandler(IDPush, ids.pushHandler)
+	h.SetStreamHandler(IDDelta, ids.deltaHandler)
+	h.Network().Notify((*netNotifiee)(ids))
+	return ids, nil
+}
+
+// Close shuts down the identify service
+func (ids *IDService) Close() error {
+	ids.cancel()
+	ids.Host.RemoveStreamHandler(ID)
+	ids.Host.RemoveStreamHandler(IDPush)
+	ids.Host.RemoveStreamHandler(IDDelta)
+	ids.Host.Network().StopNotify((*netNotifiee)(ids))
+	ids.emitters.evtPeerIdentificationCompleted.Close()
+	ids.emitters.evtPeerIdentificationFailed.Close()
+	ids.emitters.evtPeerProtocolsUpdated.Close()
+	return nil
+}
+
+// OwnObservedAddrs returns the addresses peers have reported we've dialed from
+func (ids *IDService) OwnObservedAddrs() []ma.Multiaddr {
+	return ids.observedAddrs.Addrs()
+}
+
+// IdentifyConn synchronously identifies the remote peer of the given connection
+func (ids *IDService) IdentifyConn(c network.Conn) {
+	<-ids.IdentifyWait(c)
+}
+
+// IdentifyWait returns a channel which will be closed once identify completes
+// on the given connection. Identification is started if it isn't already running.
+func (ids *IDService) IdentifyWait(c network.Conn) <-chan struct{} {
+	ids.currmu.Lock()
+	wait, found := ids.currid[c]
+	if found {
+		ids.currmu.Unlock()
+		return wait
+	}
+	wait = make(chan struct{})
+	ids.currid[c] = wait
+	ids.currmu.Unlock()
+
+	go func() {
+		defer close(wait)
+		if err := ids.identifyConn(c); err != nil {
+			ids.emitters.evtPeerIdentificationFailed.Emit(event.EvtPeerIdentificationFailed{Peer: c.RemotePeer(), Reason: err})
+			return
+		}
+		ids.emitters.evtPeerIdentificationCompleted.Emit(event.EvtPeerIdentificationCompleted{Peer: c.RemotePeer()})
+	}()
+	return wait
+}
+
+func (ids *IDService) identifyConn(c network.Conn) error {
+	s, err := c.NewStream()
+	if err != nil {
+		ids.logger.Debug("error opening identify stream", zap.Error(err), zap.String("peer.id", c.RemotePeer().String()))
+		return err
+	}
+	s.SetProtocol(ID)
+
+	// ok give the response to our handler.
+	if err := msmux.SelectProtoOrFail(ID, s); err != nil {
+		ids.logger.Debug("failed negotiating identify protocol", zap.Error(err), zap.String("peer.id", c.RemotePeer().String()))
+		s.Reset()
+		return err
+	}
+	return ids.responseHandler(s)
+}
+
+func (ids *IDService) requestHandler(s network.Stream) {
+	ids.sendIdentify(s)
+}
+
+// sendIdentify writes our identify message to s and closes it
+func (ids *IDService) sendIdentify(s network.Stream) {
+	defer helpers.FullClose(s)
+	c := s.Conn()
+
+	w := ggio.NewDelimitedWriter(s)
+	mes := pb.Identify{}
+	if err := ids.populateMessage(&mes, c); err != nil {
+		ids.logger.Error("failed to populate identify message", zap.Error(err))
+		s.Reset()
+		return
+	}
+	if err := w.WriteMsg(&mes); err != nil {
+		ids.logger.Debug("failed to send identify message", zap.Error(err), zap.String("peer.id", c.RemotePeer().String()))
+	}
+}
+
+func (ids *IDService) responseHandler(s network.Stream) error {
+	c := s.Conn()
+
+	r := ggio.NewDelimitedReader(s, network.MessageSizeMax)
+	mes := pb.Identify{}
+	if err := r.ReadMsg(&mes); err != nil {
+		ids.logger.Debug("failed to receive identify message", zap.Error(err), zap.String("peer.id", c.RemotePeer().String()))
+		s.Reset()
+		return err
+	}
+	// we only ever read a single message so close our end
+	go helpers.FullClose(s)
+	return ids.consumeMessage(&mes, c)
+}
+
+func (ids *IDService) populateMessage(mes *pb.Identify, c network.Conn) error {
+	// set protocols this node is currently handling
+	if !ids.cfg.disableProtocols {
+		mes.Protocols = ids.Host.Mux().Protocols()
+	}
+
+	// observed address so other side is informed of their
+	// "public" address, at least in relation to us.
+	if !ids.cfg.disableObservedAddr {
+		mes.ObservedAddr = c.RemoteMultiaddr().Bytes()
+	}
+
+	// set listen addrs, get our latest addrs from Host.
+	if !ids.cfg.disableListenAddrs {
+		laddrs := ids.Host.Addrs()
+		mes.ListenAddrs = make([][]byte, len(laddrs))
+		for i, addr := range laddrs {
+			mes.ListenAddrs[i] = addr.Bytes()
+		}
+	}
+
+	// set our public key
+	ownKey := ids.Host.Peerstore().PubKey(ids.Host.ID())
+	if ownKey == nil {
+		return fmt.Errorf("did not have own public key in peerstore")
+	}
+	kb, err := ic.MarshalPublicKey(ownKey)
+	if err != nil {
+		return err
+	}
+	mes.PublicKey = kb
+
+	// set protocol versions
+	pv := LibP2PVersion
+	mes.ProtocolVersion = &pv
+	if !ids.cfg.disableUserAgent {
+		av := ids.cfg.userAgent
+		mes.AgentVersion = &av
+	}
+	return nil
+}
+
+func (ids *IDService) consumeMessage(mes *pb.Identify, c network.Conn) error {
+	p := c.RemotePeer()
+
+	// the remote public key must match the peer we are talking to, otherwise
+	// nothing else in the message can be trusted.
+	if err := ids.consumeReceivedPubKey(c, mes.PublicKey); err != nil {
+		return err
+	}
+
+	// replace whatever we remembered from previous connections, peers that
+	// withhold their protocols end up with an empty set
+	if err := ids.Host.Peerstore().SetProtocols(p, mes.Protocols...); err != nil {
+		return err
+	}
+
+	// mes.ObservedAddr
+	ids.consumeObservedAddress(mes.GetObservedAddr(), c)
+
+	// mes.ListenAddrs
+	lmaddrs := make([]ma.Multiaddr, 0, len(mes.ListenAddrs))
+	for _, addr := range mes.ListenAddrs {
+		maddr, err := ma.NewMultiaddrBytes(addr)
+		if err != nil {
+			ids.logger.Debug("failed to parse listen address", zap.Error(err), zap.String("peer.id", p.String()))
+			continue
+		}
+		lmaddrs = append(lmaddrs, maddr)
+	}
+	// Extend the TTLs on the known (probably) good addresses.
+	ttl := peerstore.RecentlyConnectedAddrTTL
+	if ids.Host.Network().Connectedness(p) == network.Connected {
+		ttl = peerstore.ConnectedAddrTTL
+	}
+	ids.Host.Peerstore().AddAddrs(p, lmaddrs, ttl)
+
+	// get protocol versions
+	if pv := mes.GetProtocolVersion(); pv != "" {
+		ids.Host.Peerstore().Put(p, "ProtocolVersion", pv)
+	}
+	if av := mes.GetAgentVersion(); av != "" {
+		ids.Host.Peerstore().Put(p, "AgentVersion", av)
+	}
+	return nil
+}
+
+func (ids *IDService) consumeReceivedPubKey(c network.Conn, kb []byte) error {
+	rp := c.RemotePeer()
+
+	if kb == nil {
+		return fmt.Errorf("%s did not provide a public key", rp)
+	}
+
+	newKey, err := ic.UnmarshalPublicKey(kb)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal key from remote peer %s: %s", rp, err)
+	}
+
+	// verify key matches peer.ID
+	np, err := peer.IDFromPublicKey(newKey)
+	if err != nil {
+		return fmt.Errorf("cannot get peer.ID from key of remote peer %s: %s", rp, err)
+	}
+	if np != rp {
+		// if the newKey's peer.ID does not match known peer.ID...
+		return fmt.Errorf("received key for remote peer %s mismatch: %s", rp, np)
+	}
+
+	// check if there's a public key in the peerstore already
+	currKey := ids.Host.Peerstore().PubKey(rp)
+	if currKey == nil {
+		// no key? no auth transport. set this one.
+		return ids.Host.Peerstore().AddPubKey(rp, newKey)
+	}
+
+	// ok, we have a local key, we should verify they match.
+	if currKey.Equals(newKey) {
+		return nil // ok great. we're done.
+	}
+
+	// this is bad. it means the peerstore holds a key for this peer that
+	// disagrees with what the peer itself sent us.
+	return fmt.Errorf("identify got a different key for %s", rp)
+}
+
+func (ids *IDService) consumeObservedAddress(observed []byte, c network.Conn) {
+	if observed == nil {
+		return
+	}
+
+	maddr, err := ma.NewMultiaddrBytes(observed)
+	if err != nil {
+		ids.logger.Debug("failed to parse observed address", zap.Error(err))
+		return
+	}
+
+	// we should only use ObservedAddr when our connection's LocalAddr is one
+	// of our ListenAddrs. If we Dial out using an ephemeral addr, knowing that
+	// address's external mapping is not very useful because the port will not be
+	// the same as the listen addr.
+	ifaceaddrs, err := ids.Host.Network().InterfaceListenAddresses()
+	if err != nil {
+		ids.logger.Debug("failed to get interface listen addrs", zap.Error(err))
+		return
+	}
+
+	if !addrInAddrs(c.LocalMultiaddr(), ifaceaddrs) {
+		return
+	}
+
+	ids.observedAddrs.Add(maddr, c.RemotePeer())
+}
+
+func addrInAddrs(a ma.Multiaddr, as []ma.Multiaddr) bool {
+	for _, b := range as {
+		if a.Equal(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// netNotifiee defines methods to be used with the IDService
+type netNotifiee IDService
+
+func (nn *netNotifiee) IDService() *IDService {
+	return (*IDService)(nn)
+}
+
+// Connected satisfies the network.Notifiee interface
+func (nn *netNotifiee) Connected(n network.Network, v network.Conn) {}
+
+// Disconnected satisfies the network.Notifiee interface
+func (nn *netNotifiee) Disconnected(n network.Network, v network.Conn) {
+	ids := nn.IDService()
+
+	// Stop tracking the connection.
+	ids.currmu.Lock()
+	delete(ids.currid, v)
+	ids.currmu.Unlock()
+
+	if ids.Host.Network().Connectedness(v.RemotePeer()) != network.Connected {
+		// Last disconnect.
+		ids.pushmu.Lock()
+		delete(ids.pushers, v.RemotePeer())
+		delete(ids.limiters, v.RemotePeer())
+		ids.pushmu.Unlock()
+
+		ps := ids.Host.Peerstore()
+		ps.UpdateAddrs(v.RemotePeer(), peerstore.ConnectedAddrTTL, peerstore.RecentlyConnectedAddrTTL)
+	}
+}
+
+// OpenedStream satisfies the network.Notifiee interface
+func (nn *netNotifiee) OpenedStream(n network.Network, v network.Stream) {}
+
+// ClosedStream satisfies the network.Notifiee interface
+func (nn *netNotifiee) ClosedStream(n network.Network, v network.Stream) {}
+
+// Listen satisfies the network.Notifiee interface
+func (nn *netNotifiee) Listen(n network.Network, a ma.Multiaddr) {}
+
+// ListenClose satisfies the network.Notifiee interface
+func (nn *netNotifiee) ListenClose(n network.Network, a ma.Multiaddr) {}
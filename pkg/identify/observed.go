@@ -0,0 +1,73 @@
+package identify
+
+import (
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ActivationThresh is the number of distinct peers that must report the same
+// observed address before we consider it to be one of our own addresses.
+var ActivationThresh = 4
+
+// observedAddr is an address that remote peers told us they see us on
+type observedAddr struct {
+	addr   ma.Multiaddr
+	seenBy map[peer.ID]time.Time
+}
+
+// ObservedAddrSet keeps track of the addresses remote peers observe us on
+type ObservedAddrSet struct {
+	mu    sync.Mutex
+	addrs map[string]*observedAddr
+	ttl   time.Duration
+}
+
+// NewObservedAddrSet returns an empty ObservedAddrSet
+func NewObservedAddrSet() *ObservedAddrSet {
+	return &ObservedAddrSet{
+		addrs: make(map[string]*observedAddr),
+		ttl:   peerstore.OwnObservedAddrTTL,
+	}
+}
+
+// Add records that observer saw us on the given address
+func (oas *ObservedAddrSet) Add(observed ma.Multiaddr, observer peer.ID) {
+	oas.mu.Lock()
+	defer oas.mu.Unlock()
+	key := string(observed.Bytes())
+	oa, ok := oas.addrs[key]
+	if !ok {
+		oa = &observedAddr{addr: observed, seenBy: make(map[peer.ID]time.Time)}
+		oas.addrs[key] = oa
+	}
+	oa.seenBy[observer] = time.Now()
+}
+
+// Addrs returns the observed addresses that have been reported by enough peers
+// within the observation TTL. Stale observations are removed.
+func (oas *ObservedAddrSet) Addrs() []ma.Multiaddr {
+	oas.mu.Lock()
+	defer oas.mu.Unlock()
+	now := time.Now()
+	var out []ma.Multiaddr
+	for key, oa := range oas.addrs {
+		for p, seen := range oa.seenBy {
+			if now.Sub(seen) >= oas.ttl {
+				delete(oa.seenBy, p)
+			}
+		}
+		if len(oa.seenBy) == 0 {
+			delete(oas.addrs, key)
+			continue
+		}
+		if len(oa.seenBy) >= ActivationThresh {
+			out = append(out, oa.addr)
+		}
+	}
+	return out
+}
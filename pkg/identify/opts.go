@@ -0,0 +1,83 @@
+package identify
+
+import (
+	"errors"
+	"time"
+)
+
+// config holds the settings of an IDService. Every field that is sent to a
+// remote peer can be individually switched off, allowing operators to decide
+// how much information about the node is disclosed to the network.
+type config struct {
+	userAgent string
+
+	disableUserAgent    bool
+	disableListenAddrs  bool
+	disableObservedAddr bool
+	disableProtocols    bool
+
+	pushInterval time.Duration
+	pushBurst    int
+}
+
+// Option is used to configure the identify service
+type Option func(cfg *config) error
+
+// UserAgent sets the user agent sent to remote peers. Defaults to DefaultUserAgent.
+func UserAgent(ua string) Option {
+	return func(cfg *config) error {
+		cfg.userAgent = ua
+		return nil
+	}
+}
+
+// DiscloseUserAgent enables or disables sending our user agent (enabled by default).
+func DiscloseUserAgent(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.disableUserAgent = !enabled
+		return nil
+	}
+}
+
+// DiscloseListenAddrs enables or disables sending the addresses we
+// listen on (enabled by default).
+func DiscloseListenAddrs(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.disableListenAddrs = !enabled
+		return nil
+	}
+}
+
+// DiscloseObservedAddr enables or disables telling remote peers which address
+// we observe them on (enabled by default).
+func DiscloseObservedAddr(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.disableObservedAddr = !enabled
+		return nil
+	}
+}
+
+// DiscloseProtocols enables or disables sending the list of protocols we
+// support (enabled by default).
+func DiscloseProtocols(enabled bool) Option {
+	return func(cfg *config) error {
+		cfg.disableProtocols = !enabled
+		return nil
+	}
+}
+
+// PushRateLimit configures how often identify pushes are exchanged with a
+// single peer. Local changes are coalesced and pushed to a peer at most once
+// per interval, and a peer may push to us at most burst times in quick
+// succession, regaining one push per interval, after which its pushes are
+// dropped. Defaults to DefaultPushInterval and DefaultPushBurst.
+func PushRateLimit(interval time.Duration, burst int) Option {
+	return func(cfg *config) error {
+		if interval <= 0 || burst <= 0 {
+			return errors.New("push interval and burst must be positive")
+		}
+		cfg.pushInterval = interval
+		cfg.pushBurst = burst
+		return nil
+	}
+}
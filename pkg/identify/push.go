@@ -0,0 +1,363 @@
+package identify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/event"
+	"github.com/RTradeLtd/libp2px-core/helpers"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/peerstore"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	pb "github.com/RTradeLtd/libp2px/pkg/identify/pb"
+	"go.uber.org/zap"
+
+	ggio "github.com/gogo/protobuf/io"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// IDPush is the protocol.ID of the Identify push protocol. It sends full identify messages containing
+// the current state of the peer.
+const IDPush = "/ipfs/id/push/1.0.0"
+
+// IDDelta is the protocol.ID of the Identify delta protocol. It sends only the
+// protocols and addresses that were added or removed since the last update.
+const IDDelta = "/p2p/id/delta/1.0.0"
+
+var (
+	// DefaultPushInterval is the minimum time between two pushes to the same peer
+	DefaultPushInterval = 5 * time.Second
+	// DefaultPushBurst is the number of pushes we accept from a peer in
+	// quick succession before dropping them
+	DefaultPushBurst = 3
+	// PushTimeout bounds the time spent sending a single push
+	PushTimeout = 30 * time.Second
+)
+
+// delta accumulates protocol and address changes that still need to be pushed
+// to a peer. Opposite changes queued within a push interval cancel each other
+// out, so a protocol or address that ends up where it started isn't pushed.
+type delta struct {
+	protos map[string]bool
+	addrs  map[string]bool
+}
+
+func newDelta() *delta {
+	return &delta{
+		protos: make(map[string]bool),
+		addrs:  make(map[string]bool),
+	}
+}
+
+// merge applies the more recent changes of other on top of d
+func (d *delta) merge(other *delta) {
+	mergeChanges(d.protos, other.protos)
+	mergeChanges(d.addrs, other.addrs)
+}
+
+// mergeChanges records the changes of other in pending, dropping the
+// pending changes other reverts
+func mergeChanges(pending, other map[string]bool) {
+	for k, added := range other {
+		if prev, ok := pending[k]; ok && prev != added {
+			delete(pending, k)
+			continue
+		}
+		pending[k] = added
+	}
+}
+
+func (d *delta) empty() bool {
+	return len(d.protos) == 0 && len(d.addrs) == 0
+}
+
+func (d *delta) toProto() *pb.Delta {
+	out := new(pb.Delta)
+	for p, added := range d.protos {
+		if added {
+			out.AddedProtocols = append(out.AddedProtocols, p)
+		} else {
+			out.RmProtocols = append(out.RmProtocols, p)
+		}
+	}
+	for a, added := range d.addrs {
+		if added {
+			out.AddedAddrs = append(out.AddedAddrs, []byte(a))
+		} else {
+			out.RmAddrs = append(out.RmAddrs, []byte(a))
+		}
+	}
+	return out
+}
+
+// peerPusher coalesces the changes pushed to a single peer so that we never
+// push to it more often than once per push interval.
+type peerPusher struct {
+	mu        sync.Mutex
+	pending   *delta
+	last      time.Time
+	scheduled bool
+}
+
+// pushLimiter is a token bucket limiting how many pushes we accept from a peer
+type pushLimiter struct {
+	tokens float64
+	last   time.Time
+}
+
+func (pl *pushLimiter) allow(interval time.Duration, burst int) bool {
+	now := time.Now()
+	if pl.last.IsZero() {
+		pl.tokens = float64(burst)
+	} else {
+		pl.tokens += float64(now.Sub(pl.last)) / float64(interval)
+		if pl.tokens > float64(burst) {
+			pl.tokens = float64(burst)
+		}
+	}
+	pl.last = now
+	if pl.tokens < 1 {
+		return false
+	}
+	pl.tokens--
+	return true
+}
+
+// Push sends our full identify message to all connected peers that support
+// the identify push protocol.
+func (ids *IDService) Push() {
+	for _, p := range ids.Host.Network().Peers() {
+		go func(p peer.ID) {
+			ctx, cancel := context.WithTimeout(ids.ctx, PushTimeout)
+			defer cancel()
+			s, err := ids.Host.NewStream(network.WithNoDial(ctx, "identify push"), p, IDPush)
+			if err != nil {
+				ids.logger.Debug("failed to open push stream", zap.Error(err), zap.String("peer.id", p.String()))
+				return
+			}
+			ids.sendIdentify(s)
+		}(p)
+	}
+}
+
+// handleEvents turns local protocol and address updates into deltas queued
+// for every connected peer
+func (ids *IDService) handleEvents(sub event.Subscription) {
+	defer sub.Close()
+	for {
+		select {
+		case evt, ok := <-sub.Out():
+			if !ok {
+				return
+			}
+			d := newDelta()
+			switch evt := evt.(type) {
+			case event.EvtLocalProtocolsUpdated:
+				if ids.cfg.disableProtocols {
+					continue
+				}
+				for _, p := range evt.Added {
+					d.protos[string(p)] = true
+				}
+				for _, p := range evt.Removed {
+					d.protos[string(p)] = false
+				}
+			case eventbus.EvtLocalAddressesUpdated:
+				if ids.cfg.disableListenAddrs {
+					continue
+				}
+				for _, a := range evt.Added {
+					d.addrs[string(a.Bytes())] = true
+				}
+				for _, a := range evt.Removed {
+					d.addrs[string(a.Bytes())] = false
+				}
+			}
+			if d.empty() {
+				continue
+			}
+			for _, p := range ids.Host.Network().Peers() {
+				ids.queueDelta(p, d)
+			}
+		case <-ids.ctx.Done():
+			return
+		}
+	}
+}
+
+// queueDelta merges d into the pending changes for p, and schedules a push if
+// one isn't scheduled already
+func (ids *IDService) queueDelta(p peer.ID, d *delta) {
+	ids.pushmu.Lock()
+	pp, ok := ids.pushers[p]
+	if !ok {
+		pp = &peerPusher{}
+		ids.pushers[p] = pp
+	}
+	ids.pushmu.Unlock()
+
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.pending == nil {
+		pp.pending = newDelta()
+	}
+	pp.pending.merge(d)
+	ids.schedulePush(p, pp)
+}
+
+// requeueDelta puts back the changes of a failed push in front of the ones
+// queued since, so that they are sent with the next push
+func (ids *IDService) requeueDelta(p peer.ID, pp *peerPusher, d *delta) {
+	if ids.ctx.Err() != nil || ids.Host.Network().Connectedness(p) != network.Connected {
+		return
+	}
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	if pp.pending != nil {
+		d.merge(pp.pending)
+	}
+	pp.pending = d
+	ids.schedulePush(p, pp)
+}
+
+// schedulePush schedules a push of the pending changes for p, no sooner than
+// a push interval after the last one. pp.mu must be held.
+func (ids *IDService) schedulePush(p peer.ID, pp *peerPusher) {
+	if pp.pending.empty() || pp.scheduled {
+		return
+	}
+	pp.scheduled = true
+	wait := time.Until(pp.last.Add(ids.cfg.pushInterval))
+	if wait < 0 {
+		wait = 0
+	}
+	time.AfterFunc(wait, func() { ids.flushDelta(p, pp) })
+}
+
+func (ids *IDService) flushDelta(p peer.ID, pp *peerPusher) {
+	pp.mu.Lock()
+	d := pp.pending
+	pp.pending = nil
+	pp.scheduled = false
+	pp.last = time.Now()
+	pp.mu.Unlock()
+
+	if d == nil || d.empty() || ids.ctx.Err() != nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ids.ctx, PushTimeout)
+	defer cancel()
+	s, err := ids.Host.NewStream(network.WithNoDial(ctx, "identify delta"), p, IDDelta, IDPush)
+	if err != nil {
+		ids.logger.Debug("failed to open delta stream", zap.Error(err), zap.String("peer.id", p.String()))
+		ids.requeueDelta(p, pp, d)
+		return
+	}
+	// peers that don't speak the delta protocol get a full push instead
+	if s.Protocol() == IDPush {
+		ids.sendIdentify(s)
+		return
+	}
+	mes := &pb.Identify{Delta: d.toProto()}
+	err = ggio.NewDelimitedWriter(s).WriteMsg(mes)
+	if err == nil {
+		// the peer resets the stream instead of closing it when it drops
+		// the delta
+		err = helpers.FullClose(s)
+	} else {
+		s.Reset()
+	}
+	if err != nil {
+		// the peer may have dropped it for pushing too often, try again
+		// after the next push interval
+		ids.logger.Debug("failed to send delta, requeuing it", zap.Error(err), zap.String("peer.id", p.String()))
+		ids.requeueDelta(p, pp, d)
+	}
+}
+
+// allowPush returns whether we accept another push from p
+func (ids *IDService) allowPush(p peer.ID) bool {
+	ids.pushmu.Lock()
+	defer ids.pushmu.Unlock()
+	pl, ok := ids.limiters[p]
+	if !ok {
+		pl = &pushLimiter{}
+		ids.limiters[p] = pl
+	}
+	return pl.allow(ids.cfg.pushInterval, ids.cfg.pushBurst)
+}
+
+func (ids *IDService) pushHandler(s network.Stream) {
+	if !ids.allowPush(s.Conn().RemotePeer()) {
+		ids.logger.Debug("dropping identify push, peer is pushing too often", zap.String("peer.id", s.Conn().RemotePeer().String()))
+		s.Reset()
+		return
+	}
+	ids.responseHandler(s)
+}
+
+func (ids *IDService) deltaHandler(s network.Stream) {
+	p := s.Conn().RemotePeer()
+	if !ids.allowPush(p) {
+		ids.logger.Debug("dropping identify delta, peer is pushing too often", zap.String("peer.id", p.String()))
+		s.Reset()
+		return
+	}
+
+	r := ggio.NewDelimitedReader(s, network.MessageSizeMax)
+	mes := pb.Identify{}
+	if err := r.ReadMsg(&mes); err != nil {
+		ids.logger.Debug("failed to receive identify delta", zap.Error(err), zap.String("peer.id", p.String()))
+		s.Reset()
+		return
+	}
+	defer helpers.FullClose(s)
+
+	if err := ids.consumeDelta(p, mes.GetDelta()); err != nil {
+		ids.logger.Debug("failed to consume identify delta", zap.Error(err), zap.String("peer.id", p.String()))
+	}
+}
+
+func (ids *IDService) consumeDelta(p peer.ID, d *pb.Delta) error {
+	if d == nil {
+		return nil
+	}
+	ps := ids.Host.Peerstore()
+	if len(d.AddedProtocols) > 0 {
+		if err := ps.AddProtocols(p, d.AddedProtocols...); err != nil {
+			return err
+		}
+	}
+	if len(d.RmProtocols) > 0 {
+		if err := ps.RemoveProtocols(p, d.RmProtocols...); err != nil {
+			return err
+		}
+	}
+	for _, b := range d.AddedAddrs {
+		if addr, err := ma.NewMultiaddrBytes(b); err == nil {
+			ps.AddAddr(p, addr, peerstore.ConnectedAddrTTL)
+		}
+	}
+	for _, b := range d.RmAddrs {
+		if addr, err := ma.NewMultiaddrBytes(b); err == nil {
+			// a zero ttl removes the address
+			ps.SetAddr(p, addr, 0)
+		}
+	}
+
+	if len(d.AddedProtocols) == 0 && len(d.RmProtocols) == 0 {
+		return nil
+	}
+	evt := event.EvtPeerProtocolsUpdated{Peer: p}
+	for _, proto := range d.AddedProtocols {
+		evt.Added = append(evt.Added, protocol.ID(proto))
+	}
+	for _, proto := range d.RmProtocols {
+		evt.Removed = append(evt.Removed, protocol.ID(proto))
+	}
+	return ids.emitters.evtPeerProtocolsUpdated.Emit(evt)
+}
@@ -0,0 +1,26 @@
+package identify
+
+import "testing"
+
+func TestDeltaMerge(t *testing.T) {
+	d := newDelta()
+	d.protos["/flapping"] = true
+	d.protos["/removed"] = false
+	d.addrs["added"] = true
+
+	next := newDelta()
+	next.protos["/flapping"] = false
+	next.protos["/removed"] = false
+	next.addrs["other"] = false
+	d.merge(next)
+
+	if _, ok := d.protos["/flapping"]; ok {
+		t.Fatal("a protocol added then removed shouldn't be pushed")
+	}
+	if added, ok := d.protos["/removed"]; !ok || added {
+		t.Fatal("expected the removal to be kept")
+	}
+	if len(d.addrs) != 2 || !d.addrs["added"] || d.addrs["other"] {
+		t.Fatalf("unexpected address changes %v", d.addrs)
+	}
+}
@@ -0,0 +1,282 @@
+// Package keystore persists private keys to disk, optionally encrypted with a
+// passphrase.
+//
+// Keys are stored as their protobuf encoding. Encrypted keys are sealed with
+// XChaCha20-Poly1305 under a key derived from the passphrase with scrypt.
+package keystore
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+var (
+	// ErrNoSuchKey is returned when a key isn't in the keystore
+	ErrNoSuchKey = errors.New("no key by the given name was found")
+	// ErrKeyExists is returned when storing a key under a name already in use
+	ErrKeyExists = errors.New("key by that name already exists, refusing to overwrite")
+	// ErrInvalidName is returned for key names that aren't valid file names
+	ErrInvalidName = errors.New("key names must be non-empty, not start with a dot and not contain a path separator")
+	// ErrPassphrase is returned when an encrypted key is read without the
+	// passphrase it was encrypted with
+	ErrPassphrase = errors.New("wrong passphrase or corrupted key file")
+	// ErrEncrypted is returned when an encrypted key is read without a passphrase
+	ErrEncrypted = errors.New("key file is encrypted, a passphrase is required")
+)
+
+const (
+	// formatPlain prefixes unencrypted key files
+	formatPlain byte = 0
+	// formatScrypt prefixes key files encrypted with an scrypt derived key,
+	// followed by the salt, the nonce and the sealed key
+	formatScrypt byte = 1
+
+	saltSize = 16
+
+	// scrypt parameters recommended for interactive logins as of 2017
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// SaveKey writes sk to the file at path, encrypted with passphrase unless it
+// is empty. The file is replaced atomically and only readable by its owner.
+func SaveKey(path string, sk crypto.PrivKey, passphrase string) error {
+	data, err := encodeKey(sk, passphrase)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// encodeKey returns the content of the key file of sk
+func encodeKey(sk crypto.PrivKey, passphrase string) ([]byte, error) {
+	data, err := crypto.MarshalPrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return append([]byte{formatPlain}, data...), nil
+	}
+	return seal(data, passphrase)
+}
+
+// LoadKey reads the key stored at path by SaveKey, decrypting it with
+// passphrase if it is encrypted.
+func LoadKey(path string, passphrase string) (crypto.PrivKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%s: empty key file", path)
+	}
+	switch data[0] {
+	case formatPlain:
+		data = data[1:]
+	case formatScrypt:
+		if passphrase == "" {
+			return nil, ErrEncrypted
+		}
+		if data, err = open(data, passphrase); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: unknown key file format %d", path, data[0])
+	}
+	return crypto.UnmarshalPrivateKey(data)
+}
+
+// LoadOrCreateKey loads the key stored at path, generating a key of the
+// given type and saving it there first if there is none.
+func LoadOrCreateKey(path string, passphrase string, typ, bits int) (crypto.PrivKey, error) {
+	sk, err := LoadKey(path, passphrase)
+	if !os.IsNotExist(err) {
+		return sk, err
+	}
+	sk, _, err = crypto.GenerateKeyPairWithReader(typ, bits, rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveKey(path, sk, passphrase); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, scryptN, scryptR, scryptP, chacha20poly1305.KeySize)
+}
+
+// seal encrypts data with a key derived from passphrase, the format byte
+// being authenticated along with it
+func seal(data []byte, passphrase string) ([]byte, error) {
+	header := make([]byte, 1+saltSize+chacha20poly1305.NonceSizeX)
+	header[0] = formatScrypt
+	if _, err := rand.Read(header[1:]); err != nil {
+		return nil, err
+	}
+	salt, nonce := header[1:1+saltSize], header[1+saltSize:]
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(header, nonce, data, header[:1]), nil
+}
+
+func open(data []byte, passphrase string) ([]byte, error) {
+	if len(data) < 1+saltSize+chacha20poly1305.NonceSizeX+chacha20poly1305.Overhead {
+		return nil, ErrPassphrase
+	}
+	salt := data[1 : 1+saltSize]
+	nonce := data[1+saltSize : 1+saltSize+chacha20poly1305.NonceSizeX]
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	out, err := aead.Open(nil, nonce, data[1+saltSize+chacha20poly1305.NonceSizeX:], data[:1])
+	if err != nil {
+		return nil, ErrPassphrase
+	}
+	return out, nil
+}
+
+// Keystore stores named keys as files of a directory, all encrypted with the
+// same passphrase, or none.
+type Keystore struct {
+	dir        string
+	passphrase string
+}
+
+// NewKeystore returns a keystore storing its keys in dir, which is created if
+// it doesn't exist yet. Keys are encrypted with passphrase unless it is empty.
+func NewKeystore(dir string, passphrase string) (*Keystore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Keystore{dir: dir, passphrase: passphrase}, nil
+}
+
+func validateName(name string) error {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// Has returns whether a key is stored under name
+func (ks *Keystore) Has(name string) (bool, error) {
+	if err := validateName(name); err != nil {
+		return false, err
+	}
+	_, err := os.Stat(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Put stores sk under name, failing with ErrKeyExists if name is in use
+func (ks *Keystore) Put(name string, sk crypto.PrivKey) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	data, err := encodeKey(sk, ks.passphrase)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(ks.dir, name)
+	// O_EXCL so that concurrent puts of the same name can't both succeed
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return ErrKeyExists
+	}
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
+
+// Get returns the key stored under name
+func (ks *Keystore) Get(name string) (crypto.PrivKey, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	sk, err := LoadKey(filepath.Join(ks.dir, name), ks.passphrase)
+	if os.IsNotExist(err) {
+		return nil, ErrNoSuchKey
+	}
+	return sk, err
+}
+
+// Delete removes the key stored under name
+func (ks *Keystore) Delete(name string) error {
+	if err := validateName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(ks.dir, name))
+	if os.IsNotExist(err) {
+		return ErrNoSuchKey
+	}
+	return err
+}
+
+// List returns the sorted names of the stored keys
+func (ks *Keystore) List() ([]string, error) {
+	entries, err := ioutil.ReadDir(ks.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Mode().IsRegular() && validateName(e.Name()) == nil {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
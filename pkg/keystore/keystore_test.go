@@ -0,0 +1,141 @@
+package keystore
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/test"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "keystore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSaveLoadKey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	sk, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := filepath.Join(dir, "plain")
+	if err := SaveKey(plain, sk, ""); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadKey(plain, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equals(sk) {
+		t.Fatal("loaded key differs from the saved one")
+	}
+
+	encrypted := filepath.Join(dir, "encrypted")
+	if err := SaveKey(encrypted, sk, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err = LoadKey(encrypted, "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Equals(sk) {
+		t.Fatal("decrypted key differs from the saved one")
+	}
+	if _, err := LoadKey(encrypted, "hunter3"); err != ErrPassphrase {
+		t.Fatalf("expected ErrPassphrase, got %v", err)
+	}
+	if _, err := LoadKey(encrypted, ""); err != ErrEncrypted {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+
+	fi, err := os.Stat(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("key file is readable by others: %v", fi.Mode())
+	}
+}
+
+func TestLoadOrCreateKey(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "identity")
+
+	sk, err := LoadOrCreateKey(path, "", crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sk.Type() != crypto.Ed25519 {
+		t.Fatalf("expected an Ed25519 key, got type %d", sk.Type())
+	}
+	again, err := LoadOrCreateKey(path, "", crypto.Ed25519, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Equals(sk) {
+		t.Fatal("a new key was generated instead of loading the existing one")
+	}
+}
+
+func TestKeystore(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	ks, err := NewKeystore(filepath.Join(dir, "keys"), "passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sk1, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sk2, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("b", sk2); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("a", sk1); err != nil {
+		t.Fatal(err)
+	}
+	if err := ks.Put("a", sk2); err != ErrKeyExists {
+		t.Fatalf("expected ErrKeyExists, got %v", err)
+	}
+	if err := ks.Put("../a", sk2); err != ErrInvalidName {
+		t.Fatalf("expected ErrInvalidName, got %v", err)
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Fatalf("unexpected key names %v", names)
+	}
+	got, err := ks.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equals(sk1) {
+		t.Fatal("got the wrong key")
+	}
+
+	if err := ks.Delete("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ks.Get("a"); err != ErrNoSuchKey {
+		t.Fatalf("expected ErrNoSuchKey, got %v", err)
+	}
+	if has, err := ks.Has("b"); err != nil || !has {
+		t.Fatalf("expected key b to be stored, got %v, %v", has, err)
+	}
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"github.com/RTradeLtd/libp2px-core/network"
+	bhost "github.com/RTradeLtd/libp2px/p2p/host/basic"
+	"github.com/RTradeLtd/libp2px/p2p/host/middleware"
+)
+
+// InstrumentHost exports the streams opened through h, by protocol and
+// direction, and the port mappings of its NAT manager through reg.
+func InstrumentHost(reg *Registry, h *bhost.BasicHost) {
+	h.Use(StreamCounter(reg.NewCounterVec("libp2px_host_streams_total",
+		"Streams opened through the host, by protocol and direction.",
+		"protocol", "direction")))
+
+	reg.NewGaugeFunc("libp2px_nat_mappings",
+		"Port mappings held on the NAT device, by protocol.",
+		[]string{"protocol"},
+		func(emit EmitFunc) {
+			nmgr := h.NATManager()
+			if nmgr == nil {
+				return
+			}
+			nat := nmgr.NAT()
+			if nat == nil {
+				return
+			}
+			counts := map[string]int{"tcp": 0, "udp": 0}
+			for _, m := range nat.Mappings() {
+				counts[m.Protocol()]++
+			}
+			for proto, n := range counts {
+				emit(float64(n), proto)
+			}
+		})
+}
+
+// StreamCounter returns a middleware counting streams into v, which must be
+// partitioned by protocol and direction
+func StreamCounter(v *CounterVec) middleware.Middleware {
+	return func(next network.StreamHandler) network.StreamHandler {
+		return func(s network.Stream) {
+			v.With(string(s.Protocol()), DirectionName(s.Stat().Direction)).Inc()
+			next(s)
+		}
+	}
+}
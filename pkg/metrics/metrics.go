@@ -0,0 +1,230 @@
+// Package metrics exports libp2px metrics in the Prometheus text exposition
+// format, without depending on the Prometheus client library.
+//
+// Counters are updated as events happen, while gauges are computed from the
+// state of the instrumented components each time the registry is scraped.
+// The Instrument functions register the metrics of a component, and must be
+// called at most once per component and registry.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Type is the type of a metric family
+type Type string
+
+const (
+	// TypeCounter is a value that only ever increases
+	TypeCounter Type = "counter"
+	// TypeGauge is a value that can go up and down
+	TypeGauge Type = "gauge"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// EmitFunc reports one sample of a metric family, with one value per label
+type EmitFunc func(value float64, labelValues ...string)
+
+type family struct {
+	name    string
+	help    string
+	typ     Type
+	labels  []string
+	collect func(emit EmitFunc)
+}
+
+// Registry holds metric families and renders them in the Prometheus text
+// format. The zero value is not usable, use NewRegistry.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewCollector registers a metric family whose samples are reported by
+// collect on every scrape. It panics if name is already registered.
+func (r *Registry) NewCollector(name, help string, typ Type, labels []string, collect func(emit EmitFunc)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.families[name]; ok {
+		panic(fmt.Sprintf("metrics: %s registered twice", name))
+	}
+	r.families[name] = &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		collect: collect,
+	}
+}
+
+// NewGaugeFunc registers a gauge whose samples are reported by collect on
+// every scrape. It panics if name is already registered.
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func(emit EmitFunc)) {
+	r.NewCollector(name, help, TypeGauge, labels, collect)
+}
+
+// NewCounterVec registers a counter partitioned by labels. It panics if name
+// is already registered.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{
+		labels:   len(labels),
+		counters: make(map[string]*Counter),
+	}
+	r.NewCollector(name, help, TypeCounter, labels, v.collect)
+	return v
+}
+
+// WriteText writes every metric family to w in the Prometheus text format,
+// ordered by name.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].name < families[j].name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns an http.Handler serving the registry in the Prometheus
+// text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+func (f *family) write(w *bufio.Writer) {
+	type sample struct {
+		labels string
+		value  float64
+	}
+	var samples []sample
+	f.collect(func(value float64, labelValues ...string) {
+		if len(labelValues) != len(f.labels) {
+			panic(fmt.Sprintf("metrics: %s expects %d labels, got %d", f.name, len(f.labels), len(labelValues)))
+		}
+		samples = append(samples, sample{
+			labels: formatLabels(f.labels, labelValues),
+			value:  value,
+		})
+	})
+	sort.Slice(samples, func(i, j int) bool {
+		return samples[i].labels < samples[j].labels
+	})
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escape(f.help, false))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", f.name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(escape(values[i], true))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+// escape escapes a help text or, if quoted is set, a label value
+func escape(s string, quoted bool) string {
+	if quoted {
+		return labelEscaper.Replace(s)
+	}
+	return helpEscaper.Replace(s)
+}
+
+// CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	labels   int
+	mu       sync.Mutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the given label values, creating it if
+// needed. It panics if the number of values does not match the labels.
+func (v *CounterVec) With(labelValues ...string) *Counter {
+	if len(labelValues) != v.labels {
+		panic(fmt.Sprintf("metrics: counter expects %d labels, got %d", v.labels, len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c, ok := v.counters[key]
+	if !ok {
+		c = &Counter{labelValues: append([]string(nil), labelValues...)}
+		v.counters[key] = c
+	}
+	return c
+}
+
+func (v *CounterVec) collect(emit EmitFunc) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, c := range v.counters {
+		emit(float64(c.Value()), c.labelValues...)
+	}
+}
+
+// Counter is a single counter of a CounterVec
+type Counter struct {
+	n           uint64 // first for 64 bit alignment
+	labelValues []string
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.n, 1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.n, n)
+}
+
+// Value returns the current value of the counter
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.n)
+}
@@ -0,0 +1,55 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	reg := NewRegistry()
+	dials := reg.NewCounterVec("test_dials_total", "Dials, by outcome.", "outcome")
+	dials.With("success").Inc()
+	dials.With("success").Add(2)
+	dials.With(`bad "\addr"`).Inc()
+	reg.NewGaugeFunc("test_conns", "Open\nconnections.", nil, func(emit EmitFunc) {
+		emit(1.5)
+	})
+	reg.NewGaugeFunc("test_empty", "Nothing.", []string{"label"}, func(emit EmitFunc) {})
+
+	expected := `# HELP test_conns Open\nconnections.
+# TYPE test_conns gauge
+test_conns 1.5
+# HELP test_dials_total Dials, by outcome.
+# TYPE test_dials_total counter
+test_dials_total{outcome="bad \"\\addr\""} 1
+test_dials_total{outcome="success"} 3
+# HELP test_empty Nothing.
+# TYPE test_empty gauge
+`
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != expected {
+		t.Fatalf("unexpected output:\n%s", buf.String())
+	}
+
+	rec := httptest.NewRecorder()
+	reg.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != ContentType {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	body, _ := ioutil.ReadAll(rec.Body)
+	if string(body) != expected {
+		t.Fatalf("unexpected body:\n%s", body)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("registering a name twice should panic")
+		}
+	}()
+	reg.NewCounterVec("test_dials_total", "Again.")
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"github.com/RTradeLtd/libp2px/pkg/pubsub"
+	pb "github.com/RTradeLtd/libp2px/pkg/pubsub/pb"
+)
+
+// PubSubTracer is a pubsub event tracer counting messages and RPCs
+type PubSubTracer struct {
+	messages *CounterVec
+	rejected *CounterVec
+	rpcs     *CounterVec
+}
+
+var _ pubsub.EventTracer = (*PubSubTracer)(nil)
+
+// NewPubSubTracer registers the pubsub metrics on reg, returning the tracer
+// updating them. Pass it to pubsub.WithEventTracer to instrument a PubSub.
+func NewPubSubTracer(reg *Registry) *PubSubTracer {
+	return &PubSubTracer{
+		messages: reg.NewCounterVec("libp2px_pubsub_messages_total",
+			"Messages published, delivered or received again, by event.",
+			"event"),
+		rejected: reg.NewCounterVec("libp2px_pubsub_rejected_total",
+			"Messages rejected, by reason.",
+			"reason"),
+		rpcs: reg.NewCounterVec("libp2px_pubsub_rpcs_total",
+			"RPCs received, sent or dropped, by event.",
+			"event"),
+	}
+}
+
+// Trace implements pubsub.EventTracer
+func (t *PubSubTracer) Trace(evt *pb.TraceEvent) {
+	switch evt.GetType() {
+	case pb.TraceEvent_PUBLISH_MESSAGE:
+		t.messages.With("published").Inc()
+	case pb.TraceEvent_DELIVER_MESSAGE:
+		t.messages.With("delivered").Inc()
+	case pb.TraceEvent_DUPLICATE_MESSAGE:
+		t.messages.With("duplicate").Inc()
+	case pb.TraceEvent_REJECT_MESSAGE:
+		t.rejected.With(evt.GetRejectMessage().GetReason()).Inc()
+	case pb.TraceEvent_RECV_RPC:
+		t.rpcs.With("received").Inc()
+	case pb.TraceEvent_SEND_RPC:
+		t.rpcs.With("sent").Inc()
+	case pb.TraceEvent_DROP_RPC:
+		t.rpcs.With("dropped").Inc()
+	}
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	circuit "github.com/RTradeLtd/libp2px/pkg/transports/circuit"
+)
+
+// InstrumentRelay exports the hops relayed by r through reg
+func InstrumentRelay(reg *Registry, r *circuit.Relay) {
+	reg.NewGaugeFunc("libp2px_relay_active_hops",
+		"Hops currently being relayed.",
+		nil,
+		func(emit EmitFunc) {
+			emit(float64(r.GetActiveHops()))
+		})
+	reg.NewCollector("libp2px_relay_hops_total",
+		"Hop requests handled by the relay, by outcome. Refused hops are labelled by status.",
+		TypeCounter,
+		[]string{"outcome"},
+		func(emit EmitFunc) {
+			st := r.HopStats()
+			emit(float64(st.Accepted), "accepted")
+			for reason, n := range st.Refused {
+				emit(float64(n), reason)
+			}
+		})
+}
@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px/pkg/connmgr"
+	"github.com/RTradeLtd/libp2px/pkg/swarm"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// InstrumentSwarm exports the dials, connections, streams and dial limiter
+// queues of s through reg. It sets s.Metrics, so it must be called before s
+// starts dialing.
+func InstrumentSwarm(reg *Registry, s *swarm.Swarm) {
+	s.Metrics = &swarmTracer{
+		dials: reg.NewCounterVec("libp2px_swarm_dials_total",
+			"Dials to a single address, by transport and outcome.",
+			"transport", "outcome"),
+	}
+
+	reg.NewGaugeFunc("libp2px_swarm_connections",
+		"Open connections, by transport and direction.",
+		[]string{"transport", "direction"},
+		func(emit EmitFunc) {
+			counts := make(map[[2]string]int)
+			for _, c := range s.Conns() {
+				counts[[2]string{TransportName(c.RemoteMultiaddr()), DirectionName(c.Stat().Direction)}]++
+			}
+			for k, n := range counts {
+				emit(float64(n), k[0], k[1])
+			}
+		})
+	reg.NewGaugeFunc("libp2px_swarm_streams",
+		"Open streams, by protocol and direction. Streams still negotiating their protocol have an empty protocol.",
+		[]string{"protocol", "direction"},
+		func(emit EmitFunc) {
+			counts := make(map[[2]string]int)
+			for _, c := range s.Conns() {
+				for _, st := range c.GetStreams() {
+					counts[[2]string{string(st.Protocol()), DirectionName(st.Stat().Direction)}]++
+				}
+			}
+			for k, n := range counts {
+				emit(float64(n), k[0], k[1])
+			}
+		})
+
+	limiterGauge := func(name, help string, value func(swarm.DialLimiterStats) int) {
+		reg.NewGaugeFunc(name, help, nil, func(emit EmitFunc) {
+			emit(float64(value(s.DialLimiterStats())))
+		})
+	}
+	limiterGauge("libp2px_swarm_dial_limiter_fd_in_use",
+		"Dials holding a file descriptor token.",
+		func(st swarm.DialLimiterStats) int { return st.FDInUse })
+	limiterGauge("libp2px_swarm_dial_limiter_fd_waiting",
+		"Dials waiting for a file descriptor token.",
+		func(st swarm.DialLimiterStats) int { return st.FDWaiting })
+	limiterGauge("libp2px_swarm_dial_limiter_peer_waiting",
+		"Dials waiting on their peer's dial limit.",
+		func(st swarm.DialLimiterStats) int { return st.PeerWaiting })
+}
+
+type swarmTracer struct {
+	dials *CounterVec
+}
+
+func (t *swarmTracer) DialCompleted(addr ma.Multiaddr, err error, took time.Duration) {
+	t.dials.With(TransportName(addr), DialOutcome(err)).Inc()
+}
+
+// DialOutcome classifies the result of a dial as one of success, canceled,
+// timeout, gated or error
+func DialOutcome(err error) string {
+	var gateErr *connmgr.GateError
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &gateErr):
+		return "gated"
+	default:
+		return "error"
+	}
+}
+
+// TransportName names the transport of an address, it's the name used by
+// swarm.TransportName
+func TransportName(addr ma.Multiaddr) string {
+	return swarm.TransportName(addr)
+}
+
+// DirectionName returns the label value of a connection or stream direction
+func DirectionName(dir network.Direction) string {
+	switch dir {
+	case network.DirInbound:
+		return "inbound"
+	case network.DirOutbound:
+		return "outbound"
+	default:
+		return "unknown"
+	}
+}
@@ -421,20 +421,27 @@ func (mp *Multiplex) handleIncoming() {
 				continue
 			}
 
+			if err := msch.reserveMemory(len(b)); err != nil {
+				// the stream is holding too much memory
+				pool.Put(b)
+				msch.Reset()
+				continue
+			}
+
 			recvTimeout.Reset(ReceiveTimeout)
 			select {
 			case msch.dataIn <- b:
 			case <-msch.reset:
-				pool.Put(b)
+				msch.putBuffer(b)
 			case <-recvTimeout.C:
-				pool.Put(b)
+				msch.putBuffer(b)
 				// Do not do this asynchronously. Otherwise, we
 				// could drop a message, then receive a message,
 				// then reset.
 				msch.Reset()
 				continue
 			case <-mp.shutdown:
-				pool.Put(b)
+				msch.putBuffer(b)
 				return
 			}
 			if !recvTimeout.Stop() {
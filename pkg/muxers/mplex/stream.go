@@ -10,6 +10,7 @@ import (
 	"github.com/RTradeLtd/libp2px-core/mux"
 
 	pool "github.com/RTradeLtd/libp2px/pkg/buffer-pool"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 )
 
 // streamID is a convenience type for operating on stream IDs
@@ -44,6 +45,8 @@ type Stream struct {
 
 	clLock       sync.Mutex
 	closedRemote bool
+	// memory accounts the messages buffered in dataIn, guarded by clLock
+	memory rcmgr.MemoryManager
 
 	// Closed when the connection is reset.
 	reset chan struct{}
@@ -89,9 +92,43 @@ func (s *Stream) waitForData() error {
 	}
 }
 
+// SetMemoryManager accounts every message buffered for the stream in mm.
+// Messages that would exceed a limit reset the stream.
+func (s *Stream) SetMemoryManager(mm rcmgr.MemoryManager) error {
+	s.clLock.Lock()
+	s.memory = mm
+	s.clLock.Unlock()
+	return nil
+}
+
+func (s *Stream) reserveMemory(size int) error {
+	s.clLock.Lock()
+	mm := s.memory
+	s.clLock.Unlock()
+	if mm == nil {
+		return nil
+	}
+	return mm.ReserveMemory(size)
+}
+
+func (s *Stream) releaseMemory(size int) {
+	s.clLock.Lock()
+	mm := s.memory
+	s.clLock.Unlock()
+	if mm != nil {
+		mm.ReleaseMemory(size)
+	}
+}
+
+// putBuffer returns a received message to the pool, releasing its memory
+func (s *Stream) putBuffer(b []byte) {
+	s.releaseMemory(len(b))
+	pool.Put(b)
+}
+
 func (s *Stream) returnBuffers() {
 	if s.exbuf != nil {
-		pool.Put(s.exbuf)
+		s.putBuffer(s.exbuf)
 		s.exbuf = nil
 		s.extra = nil
 	}
@@ -104,7 +141,7 @@ func (s *Stream) returnBuffers() {
 			if read == nil {
 				continue
 			}
-			pool.Put(read)
+			s.putBuffer(read)
 		default:
 			return
 		}
@@ -131,7 +168,7 @@ func (s *Stream) Read(b []byte) (int, error) {
 			s.extra = s.extra[read:]
 		} else {
 			if s.exbuf != nil {
-				pool.Put(s.exbuf)
+				s.putBuffer(s.exbuf)
 			}
 			s.extra = nil
 			s.exbuf = nil
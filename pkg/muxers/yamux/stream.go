@@ -7,6 +7,7 @@ import (
 	"time"
 
 	pool "github.com/RTradeLtd/libp2px/pkg/buffer-pool"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 )
 
 type streamState int
@@ -36,6 +37,14 @@ type Stream struct {
 
 	recvLock sync.Mutex
 	recvBuf  pool.Buffer
+	// recvWindowMax is the size the receive window may currently grow to,
+	// doubling up to MaxStreamWindowSize as the reader keeps up
+	recvWindowMax uint32
+
+	// memory accounts the receive window grown beyond its initial size,
+	// guarded by recvLock
+	memory         rcmgr.MemoryManager
+	memoryReserved int
 
 	sendLock sync.Mutex
 
@@ -53,6 +62,7 @@ func newStream(session *Session, id uint32, state streamState) *Stream {
 		session:       session,
 		state:         state,
 		recvWindow:    initialStreamWindow,
+		recvWindowMax: initialStreamWindow,
 		sendWindow:    initialStreamWindow,
 		readDeadline:  makePipeDeadline(),
 		writeDeadline: makePipeDeadline(),
@@ -212,8 +222,8 @@ func (s *Stream) sendWindowUpdate() error {
 	flags := s.sendFlags()
 
 	// Determine the delta update
-	max := s.session.config.MaxStreamWindowSize
 	s.recvLock.Lock()
+	max := s.recvWindowMax
 	delta := (max - uint32(s.recvBuf.Len())) - s.recvWindow
 
 	// Check if we can omit the update
@@ -222,6 +232,13 @@ func (s *Stream) sendWindowUpdate() error {
 		return nil
 	}
 
+	// The reader consumed at least half of the window, let it grow
+	if delta >= max/2 {
+		if grown := s.growWindow(max); grown > max {
+			delta += grown - max
+		}
+	}
+
 	// Update our window
 	s.recvWindow += delta
 	s.recvLock.Unlock()
@@ -234,6 +251,56 @@ func (s *Stream) sendWindowUpdate() error {
 	return nil
 }
 
+// growWindow doubles the window of size current, up to the configured
+// maximum, reserving memory for it if the stream has a memory manager. The
+// window stays at its current size if the memory can't be reserved. Must be
+// invoked with the receive lock.
+func (s *Stream) growWindow(current uint32) uint32 {
+	max := s.session.config.MaxStreamWindowSize
+	if current >= max {
+		return current
+	}
+	grow := current
+	if grow > max-current {
+		grow = max - current
+	}
+	if s.memory != nil {
+		if err := s.memory.ReserveMemory(int(grow)); err != nil {
+			// keep the window where it is until memory frees up
+			return current
+		}
+		s.memoryReserved += int(grow)
+	}
+	s.recvWindowMax = current + grow
+	return s.recvWindowMax
+}
+
+// SetMemoryManager accounts the receive window of the stream in mm. Memory
+// for the window already advertised is reserved immediately, failing if
+// that exceeds a limit.
+func (s *Stream) SetMemoryManager(mm rcmgr.MemoryManager) error {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	s.memory = mm
+	if grown := int(s.recvWindowMax) - int(initialStreamWindow); grown > 0 {
+		if err := mm.ReserveMemory(grown); err != nil {
+			return err
+		}
+		s.memoryReserved = grown
+	}
+	return nil
+}
+
+// releaseMemory releases the memory reserved for the receive window
+func (s *Stream) releaseMemory() {
+	s.recvLock.Lock()
+	defer s.recvLock.Unlock()
+	if s.memory != nil && s.memoryReserved > 0 {
+		s.memory.ReleaseMemory(s.memoryReserved)
+		s.memoryReserved = 0
+	}
+}
+
 // sendClose is used to send a FIN
 func (s *Stream) sendClose() error {
 	flags := s.sendFlags()
@@ -322,11 +389,13 @@ func (s *Stream) forceClose() {
 
 	s.readDeadline.set(time.Time{})
 	s.readDeadline.set(time.Time{})
+	s.releaseMemory()
 }
 
 // called when fully closed to release any system resources.
 func (s *Stream) cleanup() {
 	s.session.closeStream(s.id)
+	s.releaseMemory()
 	s.readDeadline.set(time.Time{})
 	s.readDeadline.set(time.Time{})
 }
@@ -0,0 +1,78 @@
+package yamux
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+)
+
+// limitedMemory is a MemoryManager refusing reservations beyond limit
+type limitedMemory struct {
+	limit, reserved int
+}
+
+func (m *limitedMemory) ReserveMemory(size int) error {
+	if m.reserved+size > m.limit {
+		return errors.New("memory limit exceeded")
+	}
+	m.reserved += size
+	return nil
+}
+
+func (m *limitedMemory) ReleaseMemory(size int) {
+	m.reserved -= size
+}
+
+func TestStreamWindowMemory(t *testing.T) {
+	c1, c2 := net.Pipe()
+	config := DefaultConfig()
+	config.MaxStreamWindowSize = 16 * initialStreamWindow
+	config.EnableKeepAlive = false
+	client, err := Client(c1, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	server, err := Server(c2, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	data := bytes.Repeat([]byte{'a'}, 8*int(config.MaxStreamWindowSize))
+	go func() {
+		s, err := client.OpenStream()
+		if err != nil {
+			return
+		}
+		s.Write(data)
+		s.Close()
+	}()
+
+	s, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only enough memory to double the window once
+	mem := &limitedMemory{limit: 2 * int(initialStreamWindow)}
+	if err := s.SetMemoryManager(mem); err != nil {
+		t.Fatal(err)
+	}
+	n, err := io.Copy(ioutil.Discard, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("expected %d bytes, got %d", len(data), n)
+	}
+	s.recvLock.Lock()
+	window := s.recvWindowMax
+	s.recvLock.Unlock()
+	if window != 2*initialStreamWindow {
+		t.Fatalf("expected the window to grow to %d, got %d", 2*initialStreamWindow, window)
+	}
+	s.Close()
+}
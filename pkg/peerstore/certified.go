@@ -0,0 +1,46 @@
+package peerstore
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	"github.com/RTradeLtd/libp2px/pkg/record"
+)
+
+// CertifiedAddrBook is implemented by address books that can tell the
+// addresses a peer certified itself, through a signed peer record, from
+// the addresses learned from third parties.
+type CertifiedAddrBook interface {
+	// ConsumePeerRecord validates a signed peer record and stores its
+	// addresses for ttl, replacing the addresses of the previous record of
+	// the peer. Records not newer than the stored one are ignored, in which
+	// case accepted is false.
+	ConsumePeerRecord(env *record.Envelope, ttl time.Duration) (accepted bool, err error)
+
+	// GetPeerRecord returns the latest signed record of p, or nil if there
+	// is none or all of its addresses have expired.
+	GetPeerRecord(p peer.ID) *record.Envelope
+}
+
+// AddrBookWrapper is implemented by peerstores built around an address book,
+// letting GetCertifiedAddrBook look through them
+type AddrBookWrapper interface {
+	// UnwrapAddrBook returns the wrapped address book
+	UnwrapAddrBook() pstore.AddrBook
+}
+
+// GetCertifiedAddrBook returns ab as a CertifiedAddrBook if it is one, looking
+// through the peerstores implementing AddrBookWrapper.
+func GetCertifiedAddrBook(ab pstore.AddrBook) (CertifiedAddrBook, bool) {
+	for {
+		if cab, ok := ab.(CertifiedAddrBook); ok {
+			return cab, true
+		}
+		w, ok := ab.(AddrBookWrapper)
+		if !ok {
+			return nil, false
+		}
+		ab = w.UnwrapAddrBook()
+	}
+}
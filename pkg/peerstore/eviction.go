@@ -0,0 +1,233 @@
+package peerstore
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ic "github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// maxEvictionScan bounds the number of peers inspected to free a single slot,
+// so that a peerstore full of peers that must be kept doesn't make every
+// write scan all of them
+const maxEvictionScan = 64
+
+// PeerRemover is implemented by peerstores, and the books they are made of,
+// that are able to forget everything they know about a peer
+type PeerRemover interface {
+	RemovePeer(peer.ID)
+}
+
+// BoundedPeerstore is a peerstore bounding the number of peers it tracks.
+// Once the bound is exceeded, the least recently updated peers are evicted.
+type BoundedPeerstore interface {
+	pstore.Peerstore
+	PeerRemover
+
+	// SetMaxPeers sets the maximum number of tracked peers, zero meaning
+	// unbounded
+	SetMaxPeers(max int)
+	// SetEvictionFilter sets the function deciding which peers must never
+	// be evicted, typically the connected and protected ones. Peers whose
+	// private key is known are never evicted.
+	SetEvictionFilter(keep func(peer.ID) bool)
+	// Evictions returns the number of peers evicted so far
+	Evictions() uint64
+}
+
+var _ BoundedPeerstore = (*peerstore)(nil)
+
+// peerLRU orders peers by the time they were last updated
+type peerLRU struct {
+	mu    sync.Mutex
+	max   int
+	keep  func(peer.ID) bool
+	order *list.List // of peer.ID, most recently updated first
+	elems map[peer.ID]*list.Element
+}
+
+func newPeerLRU() *peerLRU {
+	return &peerLRU{order: list.New(), elems: make(map[peer.ID]*list.Element)}
+}
+
+// touch marks p as the most recently updated peer, if the peerstore is bounded
+func (l *peerLRU) touch(p peer.ID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max <= 0 {
+		return
+	}
+	if e, ok := l.elems[p]; ok {
+		l.order.MoveToFront(e)
+		return
+	}
+	l.elems[p] = l.order.PushFront(p)
+}
+
+func (l *peerLRU) remove(p peer.ID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.elems[p]; ok {
+		l.order.Remove(e)
+		delete(l.elems, p)
+	}
+}
+
+// oldest returns the least recently updated peer other than skip if the
+// bound is exceeded, along with the eviction filter
+func (l *peerLRU) oldest(skip peer.ID) (peer.ID, func(peer.ID) bool, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max <= 0 || l.order.Len() <= l.max {
+		return "", nil, false
+	}
+	for e := l.order.Back(); e != nil; e = e.Prev() {
+		if p := e.Value.(peer.ID); p != skip {
+			return p, l.keep, true
+		}
+	}
+	return "", nil, false
+}
+
+// RemovePeer removes everything known about p from every book
+func (ps *peerstore) RemovePeer(p peer.ID) {
+	ps.lru.remove(p)
+	ps.AddrBook.ClearAddrs(p)
+	for _, b := range []interface{}{ps.KeyBook, ps.ProtoBook, ps.PeerMetadata, ps.Metrics} {
+		if r, ok := b.(PeerRemover); ok {
+			r.RemovePeer(p)
+		}
+	}
+}
+
+// SetMaxPeers sets the maximum number of tracked peers, evicting peers right
+// away if it is already exceeded
+func (ps *peerstore) SetMaxPeers(max int) {
+	ps.lru.mu.Lock()
+	ps.lru.max = max
+	if max <= 0 {
+		ps.lru.order.Init()
+		ps.lru.elems = make(map[peer.ID]*list.Element)
+	}
+	ps.lru.mu.Unlock()
+	if max <= 0 {
+		return
+	}
+	// start tracking the peers added while unbounded
+	for _, p := range ps.Peers() {
+		ps.lru.mu.Lock()
+		if _, ok := ps.lru.elems[p]; !ok {
+			ps.lru.elems[p] = ps.lru.order.PushBack(p)
+		}
+		ps.lru.mu.Unlock()
+	}
+	ps.evict("")
+}
+
+// SetEvictionFilter sets the function deciding which peers are never evicted
+func (ps *peerstore) SetEvictionFilter(keep func(peer.ID) bool) {
+	ps.lru.mu.Lock()
+	ps.lru.keep = keep
+	ps.lru.mu.Unlock()
+}
+
+// Evictions returns the number of peers evicted so far
+func (ps *peerstore) Evictions() uint64 {
+	return atomic.LoadUint64(&ps.evictions)
+}
+
+// updated records an update to p, evicting peers if the bound is exceeded
+func (ps *peerstore) updated(p peer.ID) {
+	ps.lru.touch(p)
+	ps.evict(p)
+}
+
+// evict removes the least recently updated peers other than skip until the
+// bound is satisfied. Peers that must be kept are moved to the front instead.
+func (ps *peerstore) evict(skip peer.ID) {
+	for i := 0; i < maxEvictionScan; i++ {
+		p, keep, ok := ps.lru.oldest(skip)
+		if !ok {
+			return
+		}
+		// the filter is called without the lock held, as it typically
+		// queries the network
+		if ps.KeyBook.PrivKey(p) != nil || (keep != nil && keep(p)) {
+			ps.lru.touch(p)
+			continue
+		}
+		ps.RemovePeer(p)
+		atomic.AddUint64(&ps.evictions, 1)
+	}
+}
+
+func (ps *peerstore) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.AddrBook.AddAddr(p, addr, ttl)
+	ps.updated(p)
+}
+
+func (ps *peerstore) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	ps.AddrBook.AddAddrs(p, addrs, ttl)
+	ps.updated(p)
+}
+
+func (ps *peerstore) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ps.AddrBook.SetAddr(p, addr, ttl)
+	ps.updated(p)
+}
+
+func (ps *peerstore) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	ps.AddrBook.SetAddrs(p, addrs, ttl)
+	ps.updated(p)
+}
+
+func (ps *peerstore) AddPubKey(p peer.ID, pk ic.PubKey) error {
+	if err := ps.KeyBook.AddPubKey(p, pk); err != nil {
+		return err
+	}
+	ps.updated(p)
+	return nil
+}
+
+func (ps *peerstore) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
+	if err := ps.KeyBook.AddPrivKey(p, sk); err != nil {
+		return err
+	}
+	ps.updated(p)
+	return nil
+}
+
+func (ps *peerstore) AddProtocols(p peer.ID, protos ...string) error {
+	if err := ps.ProtoBook.AddProtocols(p, protos...); err != nil {
+		return err
+	}
+	ps.updated(p)
+	return nil
+}
+
+func (ps *peerstore) SetProtocols(p peer.ID, protos ...string) error {
+	if err := ps.ProtoBook.SetProtocols(p, protos...); err != nil {
+		return err
+	}
+	ps.updated(p)
+	return nil
+}
+
+func (ps *peerstore) Put(p peer.ID, key string, val interface{}) error {
+	if err := ps.PeerMetadata.Put(p, key, val); err != nil {
+		return err
+	}
+	ps.updated(p)
+	return nil
+}
+
+func (ps *peerstore) RecordLatency(p peer.ID, next time.Duration) {
+	ps.Metrics.RecordLatency(p, next)
+	ps.updated(p)
+}
@@ -55,3 +55,10 @@ func (m *metrics) LatencyEWMA(p peer.ID) time.Duration {
 	m.latmu.RUnlock()
 	return time.Duration(lat)
 }
+
+// RemovePeer forgets the latency of p
+func (m *metrics) RemovePeer(p peer.ID) {
+	m.latmu.Lock()
+	delete(m.latmap, p)
+	m.latmu.Unlock()
+}
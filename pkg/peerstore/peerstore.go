@@ -10,6 +10,7 @@ import (
 )
 
 var _ pstore.Peerstore = (*peerstore)(nil)
+var _ AddrBookWrapper = (*peerstore)(nil)
 
 type peerstore struct {
 	pstore.Metrics
@@ -20,6 +21,9 @@ type peerstore struct {
 	pstore.PeerMetadata
 	ctx    context.Context
 	cancel context.CancelFunc
+
+	lru       *peerLRU
+	evictions uint64 // accessed atomically
 }
 
 // NewPeerstore creates a data structure that stores peer data, backed by the
@@ -34,9 +38,15 @@ func NewPeerstore(ctx context.Context, kb pstore.KeyBook, ab pstore.AddrBook, pb
 		Metrics:      NewMetrics(),
 		ctx:          cctx,
 		cancel:       cancel,
+		lru:          newPeerLRU(),
 	}
 }
 
+// UnwrapAddrBook returns the address book of the peerstore
+func (ps *peerstore) UnwrapAddrBook() pstore.AddrBook {
+	return ps.AddrBook
+}
+
 func (ps *peerstore) Close() (err error) {
 	ps.cancel()
 	var errs []error
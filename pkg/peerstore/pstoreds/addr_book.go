@@ -0,0 +1,473 @@
+package pstoreds
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	"github.com/RTradeLtd/libp2px/pkg/peerstore/pstoremem"
+	lru "github.com/hashicorp/golang-lru"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+)
+
+var errCorruptRecord = errors.New("corrupted address record")
+
+type expiringAddr struct {
+	Addr    ma.Multiaddr
+	TTL     time.Duration
+	Expires time.Time
+}
+
+func (e *expiringAddr) ExpiredBy(t time.Time) bool {
+	return t.After(e.Expires)
+}
+
+// addrsRecord holds every address known for a peer, and is stored as a
+// single value in the datastore
+type addrsRecord struct {
+	addrs []*expiringAddr
+}
+
+func (r *addrsRecord) find(addr ma.Multiaddr) *expiringAddr {
+	for _, a := range r.addrs {
+		if a.Addr.Equal(addr) {
+			return a
+		}
+	}
+	return nil
+}
+
+func (r *addrsRecord) remove(addr ma.Multiaddr) {
+	for i, a := range r.addrs {
+		if a.Addr.Equal(addr) {
+			r.addrs = append(r.addrs[:i], r.addrs[i+1:]...)
+			return
+		}
+	}
+}
+
+// clean drops expired addresses, returning whether any was dropped
+func (r *addrsRecord) clean(now time.Time) bool {
+	live := r.addrs[:0]
+	for _, a := range r.addrs {
+		if !a.ExpiredBy(now) {
+			live = append(live, a)
+		}
+	}
+	for i := len(live); i < len(r.addrs); i++ {
+		r.addrs[i] = nil
+	}
+	dropped := len(live) != len(r.addrs)
+	r.addrs = live
+	return dropped
+}
+
+// marshal encodes the record as a uvarint count of addresses, each encoded as
+// its uvarint length prefixed bytes, its ttl, and the seconds and nanoseconds
+// of its expiry
+func (r *addrsRecord) marshal() []byte {
+	var (
+		buf  []byte
+		vbuf [binary.MaxVarintLen64]byte
+	)
+	buf = append(buf, vbuf[:binary.PutUvarint(vbuf[:], uint64(len(r.addrs)))]...)
+	for _, a := range r.addrs {
+		b := a.Addr.Bytes()
+		buf = append(buf, vbuf[:binary.PutUvarint(vbuf[:], uint64(len(b)))]...)
+		buf = append(buf, b...)
+		buf = append(buf, vbuf[:binary.PutVarint(vbuf[:], int64(a.TTL))]...)
+		buf = append(buf, vbuf[:binary.PutVarint(vbuf[:], a.Expires.Unix())]...)
+		buf = append(buf, vbuf[:binary.PutUvarint(vbuf[:], uint64(a.Expires.Nanosecond()))]...)
+	}
+	return buf
+}
+
+func unmarshalAddrsRecord(data []byte) (*addrsRecord, error) {
+	uvarint := func() (uint64, error) {
+		v, n := binary.Uvarint(data)
+		if n <= 0 {
+			return 0, errCorruptRecord
+		}
+		data = data[n:]
+		return v, nil
+	}
+	varint := func() (int64, error) {
+		v, n := binary.Varint(data)
+		if n <= 0 {
+			return 0, errCorruptRecord
+		}
+		data = data[n:]
+		return v, nil
+	}
+	count, err := uvarint()
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(len(data)) {
+		return nil, errCorruptRecord
+	}
+	r := &addrsRecord{addrs: make([]*expiringAddr, 0, count)}
+	for i := uint64(0); i < count; i++ {
+		l, err := uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if l > uint64(len(data)) {
+			return nil, errCorruptRecord
+		}
+		addr, err := ma.NewMultiaddrBytes(data[:l])
+		if err != nil {
+			return nil, err
+		}
+		data = data[l:]
+		ttl, err := varint()
+		if err != nil {
+			return nil, err
+		}
+		sec, err := varint()
+		if err != nil {
+			return nil, err
+		}
+		nsec, err := uvarint()
+		if err != nil {
+			return nil, err
+		}
+		r.addrs = append(r.addrs, &expiringAddr{
+			Addr:    addr,
+			TTL:     time.Duration(ttl),
+			Expires: time.Unix(sec, int64(nsec)),
+		})
+	}
+	return r, nil
+}
+
+// cache is the read-through cache of address records
+type cache interface {
+	Get(key interface{}) (value interface{}, ok bool)
+	Add(key, value interface{})
+	Remove(key interface{})
+}
+
+type noopCache struct{}
+
+func (noopCache) Get(interface{}) (interface{}, bool) { return nil, false }
+func (noopCache) Add(interface{}, interface{})        {}
+func (noopCache) Remove(interface{})                  {}
+
+// dsAddrBook is an address book persisting the addresses of every peer as a
+// single record, with an LRU cache of the most recently used records in
+// front of the datastore.
+type dsAddrBook struct {
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	ds     Datastore
+	cache  cache
+	logger *zap.Logger
+
+	// guard the read-modify-write cycles on the records, sharded by peer
+	locks [256]sync.RWMutex
+
+	subManager *pstoremem.AddrSubManager
+}
+
+var _ pstore.AddrBook = (*dsAddrBook)(nil)
+
+// NewAddrBook returns an address book persisted to store, with the same TTL
+// semantics as the in-memory address book. Expired addresses are purged from
+// the store every opts.GCInterval.
+func NewAddrBook(ctx context.Context, logger *zap.Logger, store Datastore, opts Options) (pstore.AddrBook, error) {
+	var c cache = noopCache{}
+	if opts.CacheSize > 0 {
+		arc, err := lru.NewARC(int(opts.CacheSize))
+		if err != nil {
+			return nil, err
+		}
+		c = arc
+	}
+	cctx, cancel := context.WithCancel(ctx)
+	ab := &dsAddrBook{
+		ctx:        cctx,
+		cancel:     cancel,
+		ds:         store,
+		cache:      c,
+		logger:     logger.Named("pstoreds"),
+		subManager: pstoremem.NewAddrSubManager(),
+	}
+	if opts.GCInterval > 0 {
+		ab.wg.Add(1)
+		go ab.background(opts.GCInterval)
+	}
+	return ab, nil
+}
+
+// background periodically schedules a gc
+func (ab *dsAddrBook) background(interval time.Duration) {
+	defer ab.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ab.gc()
+		case <-ab.ctx.Done():
+			return
+		}
+	}
+}
+
+// Close stops the garbage collection. The datastore is left open.
+func (ab *dsAddrBook) Close() error {
+	ab.cancel()
+	ab.wg.Wait()
+	return nil
+}
+
+// gc purges expired addresses from every record in the datastore
+func (ab *dsAddrBook) gc() {
+	now := time.Now()
+	err := ab.ds.Query(addrsPrefix, func(key string, _ []byte) error {
+		p, err := peerFromKey(addrsPrefix, key)
+		if err != nil {
+			ab.logger.Warn("skipping invalid address record key", zap.String("key", key), zap.Error(err))
+			return nil
+		}
+		lk := ab.lock(p)
+		lk.Lock()
+		defer lk.Unlock()
+		rec, err := ab.load(p)
+		if err != nil {
+			ab.logger.Error("failed to load address record", zap.String("peer.id", p.String()), zap.Error(err))
+			return nil
+		}
+		if rec.clean(now) {
+			ab.flush(p, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		ab.logger.Error("address book gc failed", zap.Error(err))
+	}
+}
+
+func (ab *dsAddrBook) lock(p peer.ID) *sync.RWMutex {
+	return &ab.locks[byte(p[len(p)-1])]
+}
+
+// load returns the record of p from the cache, or reads it from the datastore
+// into the cache. Must be called with the lock of p held. The returned record
+// may only be modified with the write lock held.
+func (ab *dsAddrBook) load(p peer.ID) (*addrsRecord, error) {
+	if rec, ok := ab.cache.Get(p); ok {
+		return rec.(*addrsRecord), nil
+	}
+	data, err := ab.ds.Get(peerKey(addrsPrefix, p))
+	if err == ErrNotFound {
+		return &addrsRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rec, err := unmarshalAddrsRecord(data)
+	if err != nil {
+		return nil, err
+	}
+	ab.cache.Add(p, rec)
+	return rec, nil
+}
+
+// flush writes the record of p back to the datastore, dropping its expired
+// addresses. Must be called with the write lock of p held.
+func (ab *dsAddrBook) flush(p peer.ID, rec *addrsRecord) {
+	rec.clean(time.Now())
+	var err error
+	if len(rec.addrs) == 0 {
+		ab.cache.Remove(p)
+		err = ab.ds.Delete(peerKey(addrsPrefix, p))
+	} else {
+		ab.cache.Add(p, rec)
+		err = ab.ds.Put(peerKey(addrsPrefix, p), rec.marshal())
+	}
+	if err != nil {
+		// the cache must not diverge from the datastore
+		ab.cache.Remove(p)
+		ab.logger.Error("failed to write address record", zap.String("peer.id", p.String()), zap.Error(err))
+	}
+}
+
+// PeersWithAddrs returns every peer with a record in the datastore
+func (ab *dsAddrBook) PeersWithAddrs() peer.IDSlice {
+	var pids peer.IDSlice
+	err := ab.ds.Query(addrsPrefix, func(key string, _ []byte) error {
+		p, err := peerFromKey(addrsPrefix, key)
+		if err != nil {
+			ab.logger.Warn("skipping invalid address record key", zap.String("key", key), zap.Error(err))
+			return nil
+		}
+		pids = append(pids, p)
+		return nil
+	})
+	if err != nil {
+		ab.logger.Error("failed to query peers with addresses", zap.Error(err))
+	}
+	return pids
+}
+
+// AddAddr calls AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+func (ab *dsAddrBook) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ab.AddAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+// AddAddrs adds addresses valid for the given ttl. This function never
+// reduces the TTL or expiration of an address.
+func (ab *dsAddrBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	lk := ab.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	rec, err := ab.load(p)
+	if err != nil {
+		ab.logger.Error("failed to load address record", zap.String("peer.id", p.String()), zap.Error(err))
+		return
+	}
+	exp := time.Now().Add(ttl)
+	for _, addr := range addrs {
+		if addr == nil {
+			continue
+		}
+		a := rec.find(addr)
+		if a == nil {
+			rec.addrs = append(rec.addrs, &expiringAddr{Addr: addr, Expires: exp, TTL: ttl})
+			ab.subManager.BroadcastAddr(p, addr)
+			continue
+		}
+		// Update expiration/TTL independently.
+		// We never want to reduce either.
+		if ttl > a.TTL {
+			a.TTL = ttl
+		}
+		if exp.After(a.Expires) {
+			a.Expires = exp
+		}
+	}
+	ab.flush(p, rec)
+}
+
+// SetAddr calls SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+func (ab *dsAddrBook) SetAddr(p peer.ID, addr ma.Multiaddr, ttl time.Duration) {
+	ab.SetAddrs(p, []ma.Multiaddr{addr}, ttl)
+}
+
+// SetAddrs sets the ttl on addresses, clearing any TTL there previously. A
+// ttl of zero or less removes the addresses.
+func (ab *dsAddrBook) SetAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
+	lk := ab.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	rec, err := ab.load(p)
+	if err != nil {
+		ab.logger.Error("failed to load address record", zap.String("peer.id", p.String()), zap.Error(err))
+		return
+	}
+	exp := time.Now().Add(ttl)
+	for _, addr := range addrs {
+		if addr == nil {
+			continue
+		}
+		if ttl <= 0 {
+			rec.remove(addr)
+			continue
+		}
+		if a := rec.find(addr); a != nil {
+			a.TTL, a.Expires = ttl, exp
+		} else {
+			rec.addrs = append(rec.addrs, &expiringAddr{Addr: addr, Expires: exp, TTL: ttl})
+		}
+		ab.subManager.BroadcastAddr(p, addr)
+	}
+	ab.flush(p, rec)
+}
+
+// UpdateAddrs updates the addresses associated with the given peer that have
+// the given oldTTL to have the given newTTL.
+func (ab *dsAddrBook) UpdateAddrs(p peer.ID, oldTTL time.Duration, newTTL time.Duration) {
+	lk := ab.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	rec, err := ab.load(p)
+	if err != nil {
+		ab.logger.Error("failed to load address record", zap.String("peer.id", p.String()), zap.Error(err))
+		return
+	}
+	if len(rec.addrs) == 0 {
+		return
+	}
+	exp := time.Now().Add(newTTL)
+	for _, a := range rec.addrs {
+		if a.TTL == oldTTL {
+			a.TTL, a.Expires = newTTL, exp
+		}
+	}
+	ab.flush(p, rec)
+}
+
+// Addrs returns all known (and valid) addresses for a given peer
+func (ab *dsAddrBook) Addrs(p peer.ID) []ma.Multiaddr {
+	lk := ab.lock(p)
+	lk.RLock()
+	defer lk.RUnlock()
+	return ab.addrs(p)
+}
+
+// addrs returns the valid addresses of p. Must be called with the lock of p held.
+func (ab *dsAddrBook) addrs(p peer.ID) []ma.Multiaddr {
+	rec, err := ab.load(p)
+	if err != nil {
+		ab.logger.Error("failed to load address record", zap.String("peer.id", p.String()), zap.Error(err))
+		return nil
+	}
+	if len(rec.addrs) == 0 {
+		return nil
+	}
+	now := time.Now()
+	good := make([]ma.Multiaddr, 0, len(rec.addrs))
+	for _, a := range rec.addrs {
+		if !a.ExpiredBy(now) {
+			good = append(good, a.Addr)
+		}
+	}
+	return good
+}
+
+// ClearAddrs removes all previously stored addresses
+func (ab *dsAddrBook) ClearAddrs(p peer.ID) {
+	lk := ab.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	ab.cache.Remove(p)
+	if err := ab.ds.Delete(peerKey(addrsPrefix, p)); err != nil {
+		ab.logger.Error("failed to delete address record", zap.String("peer.id", p.String()), zap.Error(err))
+	}
+}
+
+// AddrStream returns a channel on which all new addresses discovered for a
+// given peer ID will be published.
+func (ab *dsAddrBook) AddrStream(ctx context.Context, p peer.ID) <-chan ma.Multiaddr {
+	lk := ab.lock(p)
+	lk.RLock()
+	defer lk.RUnlock()
+	return ab.subManager.AddrStream(ctx, p, ab.addrs(p))
+}
@@ -0,0 +1,109 @@
+package pstoreds
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound is returned by Datastore.Get when no value is stored under a key
+var ErrNotFound = errors.New("datastore: key not found")
+
+// Datastore is the key-value store a persistent peerstore is written to.
+// Implementations must be safe for concurrent use.
+type Datastore interface {
+	// Get returns the value stored under key, or ErrNotFound
+	Get(key string) ([]byte, error)
+	// Put stores value under key, replacing any previous value
+	Put(key string, value []byte) error
+	// Delete removes the value stored under key, if any
+	Delete(key string) error
+	// Query calls fn for every key starting with prefix, stopping at the first
+	// error returned by fn. The datastore may be modified from within fn.
+	Query(prefix string, fn func(key string, value []byte) error) error
+
+	io.Closer
+}
+
+// MapDatastore is a Datastore held entirely in memory
+type MapDatastore struct {
+	mu     sync.RWMutex
+	values map[string][]byte
+}
+
+var _ Datastore = (*MapDatastore)(nil)
+
+// NewMapDatastore returns an empty in-memory Datastore
+func NewMapDatastore() *MapDatastore {
+	return &MapDatastore{values: make(map[string][]byte)}
+}
+
+// Get returns the value stored under key
+func (d *MapDatastore) Get(key string) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	v, ok := d.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put stores value under key
+func (d *MapDatastore) Put(key string, value []byte) error {
+	d.mu.Lock()
+	d.values[key] = append([]byte(nil), value...)
+	d.mu.Unlock()
+	return nil
+}
+
+// Delete removes the value stored under key
+func (d *MapDatastore) Delete(key string) error {
+	d.mu.Lock()
+	delete(d.values, key)
+	d.mu.Unlock()
+	return nil
+}
+
+// Query calls fn for every key starting with prefix
+func (d *MapDatastore) Query(prefix string, fn func(key string, value []byte) error) error {
+	return queryEntries(d.entries(prefix), fn)
+}
+
+func (d *MapDatastore) entries(prefix string) []entry {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return collect(d.values, prefix)
+}
+
+// Close is a noop
+func (d *MapDatastore) Close() error {
+	return nil
+}
+
+type entry struct {
+	key   string
+	value []byte
+}
+
+// collect snapshots the entries of values whose key starts with prefix, so
+// that query callbacks run without the datastore lock held
+func collect(values map[string][]byte, prefix string) []entry {
+	var out []entry
+	for k, v := range values {
+		if strings.HasPrefix(k, prefix) {
+			out = append(out, entry{key: k, value: append([]byte(nil), v...)})
+		}
+	}
+	return out
+}
+
+func queryEntries(entries []entry, fn func(key string, value []byte) error) error {
+	for _, e := range entries {
+		if err := fn(e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
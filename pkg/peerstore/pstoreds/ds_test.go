@@ -0,0 +1,197 @@
+package pstoreds
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	tu "github.com/RTradeLtd/libp2px-core/test"
+	pt "github.com/RTradeLtd/libp2px/pkg/peerstore/test"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/zap"
+)
+
+func tempDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "pstoreds")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir, func() { os.RemoveAll(dir) }
+}
+
+func peerstoreFactory(t *testing.T, opts Options) pt.PeerstoreFactory {
+	return func() (pstore.Peerstore, func()) {
+		dir, cleanup := tempDir(t)
+		ps, err := NewFilePeerstore(context.Background(), zap.NewNop(), filepath.Join(dir, "peerstore"), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ps, func() {
+			ps.Close()
+			cleanup()
+		}
+	}
+}
+
+func TestDsPeerstore(t *testing.T) {
+	t.Run("Cacheful", func(t *testing.T) {
+		pt.TestPeerstore(t, peerstoreFactory(t, DefaultOpts()))
+	})
+	t.Run("Cacheless", func(t *testing.T) {
+		pt.TestPeerstore(t, peerstoreFactory(t, Options{}))
+	})
+}
+
+func TestDsAddrBook(t *testing.T) {
+	for name, opts := range map[string]Options{"Cacheful": DefaultOpts(), "Cacheless": {}} {
+		factory := peerstoreFactory(t, opts)
+		t.Run(name, func(t *testing.T) {
+			pt.TestAddrBook(t, func() (pstore.AddrBook, func()) {
+				return factory()
+			})
+		})
+	}
+}
+
+func TestDsKeyBook(t *testing.T) {
+	factory := peerstoreFactory(t, DefaultOpts())
+	pt.TestKeyBook(t, func() (pstore.KeyBook, func()) {
+		return factory()
+	})
+}
+
+func TestMapDatastorePeerstore(t *testing.T) {
+	pt.TestPeerstore(t, func() (pstore.Peerstore, func()) {
+		ps, err := NewPeerstore(context.Background(), zap.NewNop(), NewMapDatastore(), DefaultOpts())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ps, func() { ps.Close() }
+	})
+}
+
+func TestPersistence(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "peerstore")
+
+	p, err := tu.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4001")
+	expiring, _ := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4002")
+
+	ps, err := NewFilePeerstore(context.Background(), zap.NewNop(), path, DefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ps.AddAddr(p, addr, time.Hour)
+	ps.AddAddr(p, expiring, 50*time.Millisecond)
+	if err := ps.AddProtocols(p, "/foo/1.0.0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Put(p, "AgentVersion", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	ps, err = NewFilePeerstore(context.Background(), zap.NewNop(), path, DefaultOpts())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	if addrs := ps.Addrs(p); len(addrs) != 1 || !addrs[0].Equal(addr) {
+		t.Fatalf("expected only %s to survive a restart, got %v", addr, addrs)
+	}
+	if protos, err := ps.GetProtocols(p); err != nil || len(protos) != 1 || protos[0] != "/foo/1.0.0" {
+		t.Fatalf("unexpected protocols %v (%v)", protos, err)
+	}
+	if v, err := ps.Get(p, "AgentVersion"); err != nil || v != "test" {
+		t.Fatalf("unexpected agent version %v (%v)", v, err)
+	}
+}
+
+func TestAddrBookGC(t *testing.T) {
+	store := NewMapDatastore()
+	ab, err := NewAddrBook(context.Background(), zap.NewNop(), store, Options{CacheSize: 16, GCInterval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ab.(*dsAddrBook).Close()
+
+	p, err := tu.RandPeerID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr, _ := ma.NewMultiaddr("/ip4/1.2.3.4/tcp/4001")
+	ab.AddAddr(p, addr, 10*time.Millisecond)
+	if _, err := store.Get(peerKey(addrsPrefix, p)); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if _, err := store.Get(peerKey(addrsPrefix, p)); err != ErrNotFound {
+		t.Fatalf("expected the expired record to be collected, got %v", err)
+	}
+}
+
+func TestFileDatastoreCompaction(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+	path := filepath.Join(dir, "log")
+
+	d, err := NewFileDatastore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4*minCompactGarbage; i++ {
+		if err := d.Put("/key", []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Put("/other", []byte("value")); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Delete("/other"); err != nil {
+		t.Fatal(err)
+	}
+	if d.garbage > minCompactGarbage+2 {
+		t.Fatalf("log was not compacted, %d stale records", d.garbage)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a write interrupted by a crash
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := encodeRecord(opPut, "/torn", []byte("value"))
+	f.Write(rec[:len(rec)-2])
+	f.Close()
+
+	d, err = NewFileDatastore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	v, err := d.Get("/key")
+	if err != nil || v[0] != byte((4*minCompactGarbage-1)%256) {
+		t.Fatalf("unexpected value %v (%v)", v, err)
+	}
+	for _, key := range []string{"/other", "/torn"} {
+		if _, err := d.Get(key); err != ErrNotFound {
+			t.Fatalf("expected %s to be missing, got %v", key, err)
+		}
+	}
+}
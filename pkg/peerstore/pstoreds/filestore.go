@@ -0,0 +1,268 @@
+package pstoreds
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	opPut byte = iota + 1
+	opDelete
+)
+
+// compaction is triggered once the log holds more stale records than this,
+// and more stale records than live ones
+const minCompactGarbage = 1024
+
+// maxChunkSize bounds the keys and values read back from the log, so that a
+// corrupted length prefix doesn't exhaust memory
+const maxChunkSize = 64 << 20
+
+// ErrClosed is returned when using a FileDatastore after Close
+var ErrClosed = errors.New("datastore: closed")
+
+// FileDatastore is the embedded default Datastore. Every value is kept in
+// memory and every write is appended to a log file, which is replayed when the
+// datastore is opened and rewritten once it holds mostly stale records.
+//
+// Writes are not synced to disk individually, so the last writes before a
+// crash may be lost; a log truncated mid-record is repaired on open.
+type FileDatastore struct {
+	path string
+
+	mu      sync.RWMutex
+	f       *os.File
+	values  map[string][]byte
+	garbage int
+	closed  bool
+}
+
+var _ Datastore = (*FileDatastore)(nil)
+
+// NewFileDatastore opens the datastore logged to the file at path, creating it
+// if it doesn't exist.
+func NewFileDatastore(path string) (*FileDatastore, error) {
+	d := &FileDatastore{path: path, values: make(map[string][]byte)}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	if err := d.compact(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load replays the log into memory
+func (d *FileDatastore) load() error {
+	f, err := os.Open(d.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		op, key, value, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err == io.ErrUnexpectedEOF {
+			// the last write was interrupted, the rewrite in compact drops it
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := d.values[key]; ok {
+			d.garbage++
+		}
+		switch op {
+		case opPut:
+			d.values[key] = value
+		case opDelete:
+			delete(d.values, key)
+			d.garbage++
+		default:
+			return errors.New("datastore: corrupted log " + d.path)
+		}
+	}
+}
+
+// compact rewrites the log with only the live values, and reopens it for
+// appending. Must be called with the lock held.
+func (d *FileDatastore) compact() error {
+	tmp := d.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for k, v := range d.values {
+		if _, err := w.Write(encodeRecord(opPut, k, v)); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if d.f != nil {
+		d.f.Close()
+		d.f = nil
+	}
+	if err := os.Rename(tmp, d.path); err != nil {
+		return err
+	}
+	d.f, err = os.OpenFile(d.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	d.garbage = 0
+	return nil
+}
+
+// append writes a record to the log, compacting it if it holds too much
+// garbage. Must be called with the lock held.
+func (d *FileDatastore) append(op byte, key string, value []byte) error {
+	if _, err := d.f.Write(encodeRecord(op, key, value)); err != nil {
+		return err
+	}
+	if d.garbage > minCompactGarbage && d.garbage > len(d.values) {
+		return d.compact()
+	}
+	return nil
+}
+
+// Get returns the value stored under key
+func (d *FileDatastore) Get(key string) ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return nil, ErrClosed
+	}
+	v, ok := d.values[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte(nil), v...), nil
+}
+
+// Put stores value under key
+func (d *FileDatastore) Put(key string, value []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if _, ok := d.values[key]; ok {
+		d.garbage++
+	}
+	d.values[key] = append([]byte(nil), value...)
+	return d.append(opPut, key, value)
+}
+
+// Delete removes the value stored under key
+func (d *FileDatastore) Delete(key string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return ErrClosed
+	}
+	if _, ok := d.values[key]; !ok {
+		return nil
+	}
+	delete(d.values, key)
+	// both the put and the delete record are now stale
+	d.garbage += 2
+	return d.append(opDelete, key, nil)
+}
+
+// Query calls fn for every key starting with prefix
+func (d *FileDatastore) Query(prefix string, fn func(key string, value []byte) error) error {
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return ErrClosed
+	}
+	entries := collect(d.values, prefix)
+	d.mu.RUnlock()
+	return queryEntries(entries, fn)
+}
+
+// Close syncs and closes the log
+func (d *FileDatastore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	if err := d.f.Sync(); err != nil {
+		d.f.Close()
+		return err
+	}
+	return d.f.Close()
+}
+
+// encodeRecord encodes a log record as the op byte followed by the uvarint
+// length prefixed key and value
+func encodeRecord(op byte, key string, value []byte) []byte {
+	buf := make([]byte, 1, 1+2*binary.MaxVarintLen64+len(key)+len(value))
+	buf[0] = op
+	var lbuf [binary.MaxVarintLen64]byte
+	buf = append(buf, lbuf[:binary.PutUvarint(lbuf[:], uint64(len(key)))]...)
+	buf = append(buf, key...)
+	buf = append(buf, lbuf[:binary.PutUvarint(lbuf[:], uint64(len(value)))]...)
+	return append(buf, value...)
+}
+
+func readRecord(r *bufio.Reader) (op byte, key string, value []byte, err error) {
+	op, err = r.ReadByte()
+	if err != nil {
+		return 0, "", nil, err
+	}
+	kb, err := readChunk(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	value, err = readChunk(r)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	return op, string(kb), value, nil
+}
+
+func readChunk(r *bufio.Reader) ([]byte, error) {
+	l, err := binary.ReadUvarint(r)
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if l > maxChunkSize {
+		return nil, errors.New("datastore: corrupted log record")
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
@@ -0,0 +1,129 @@
+package pstoreds
+
+import (
+	"errors"
+
+	ic "github.com/RTradeLtd/libp2px-core/crypto"
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	"go.uber.org/zap"
+)
+
+const (
+	pubSuffix  = "/pub"
+	privSuffix = "/priv"
+)
+
+type dsKeyBook struct {
+	ds     Datastore
+	logger *zap.Logger
+}
+
+var _ pstore.KeyBook = (*dsKeyBook)(nil)
+
+// NewKeyBook returns a key book persisted to store
+func NewKeyBook(logger *zap.Logger, store Datastore) pstore.KeyBook {
+	return &dsKeyBook{ds: store, logger: logger.Named("pstoreds")}
+}
+
+func (kb *dsKeyBook) PubKey(p peer.ID) ic.PubKey {
+	key := peerKey(keysPrefix, p) + pubSuffix
+
+	data, err := kb.ds.Get(key)
+	if err == nil {
+		pk, err := ic.UnmarshalPublicKey(data)
+		if err != nil {
+			kb.logger.Error("failed to unmarshal public key", zap.String("peer.id", p.String()), zap.Error(err))
+			return nil
+		}
+		return pk
+	}
+	if err != ErrNotFound {
+		kb.logger.Error("failed to load public key", zap.String("peer.id", p.String()), zap.Error(err))
+		return nil
+	}
+
+	pk, err := p.ExtractPublicKey()
+	if err != nil || pk == nil {
+		return nil
+	}
+	if data, err := ic.MarshalPublicKey(pk); err == nil {
+		if err := kb.ds.Put(key, data); err != nil {
+			kb.logger.Error("failed to store public key", zap.String("peer.id", p.String()), zap.Error(err))
+		}
+	}
+	return pk
+}
+
+func (kb *dsKeyBook) AddPubKey(p peer.ID, pk ic.PubKey) error {
+	// check it's correct first
+	if !p.MatchesPublicKey(pk) {
+		return errors.New("ID does not match PublicKey")
+	}
+	data, err := ic.MarshalPublicKey(pk)
+	if err != nil {
+		return err
+	}
+	return kb.ds.Put(peerKey(keysPrefix, p)+pubSuffix, data)
+}
+
+func (kb *dsKeyBook) PrivKey(p peer.ID) ic.PrivKey {
+	data, err := kb.ds.Get(peerKey(keysPrefix, p) + privSuffix)
+	if err != nil {
+		if err != ErrNotFound {
+			kb.logger.Error("failed to load private key", zap.String("peer.id", p.String()), zap.Error(err))
+		}
+		return nil
+	}
+	sk, err := ic.UnmarshalPrivateKey(data)
+	if err != nil {
+		kb.logger.Error("failed to unmarshal private key", zap.String("peer.id", p.String()), zap.Error(err))
+		return nil
+	}
+	return sk
+}
+
+func (kb *dsKeyBook) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
+	if sk == nil {
+		return errors.New("sk is nil (PrivKey)")
+	}
+	// check it's correct first
+	if !p.MatchesPrivateKey(sk) {
+		return errors.New("ID does not match PrivateKey")
+	}
+	data, err := ic.MarshalPrivateKey(sk)
+	if err != nil {
+		return err
+	}
+	return kb.ds.Put(peerKey(keysPrefix, p)+privSuffix, data)
+}
+
+func (kb *dsKeyBook) PeersWithKeys() peer.IDSlice {
+	set := make(map[peer.ID]struct{})
+	err := kb.ds.Query(keysPrefix, func(key string, _ []byte) error {
+		p, err := peerFromKey(keysPrefix, key)
+		if err != nil {
+			kb.logger.Warn("skipping invalid key record key", zap.String("key", key), zap.Error(err))
+			return nil
+		}
+		set[p] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		kb.logger.Error("failed to query peers with keys", zap.Error(err))
+	}
+	ps := make(peer.IDSlice, 0, len(set))
+	for p := range set {
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// RemovePeer deletes the keys of p
+func (kb *dsKeyBook) RemovePeer(p peer.ID) {
+	for _, suffix := range []string{pubSuffix, privSuffix} {
+		if err := kb.ds.Delete(peerKey(keysPrefix, p) + suffix); err != nil {
+			kb.logger.Error("failed to delete key", zap.String("peer.id", p.String()), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package pstoreds
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+)
+
+type dsPeerMetadata struct {
+	ds Datastore
+}
+
+var _ pstore.PeerMetadata = (*dsPeerMetadata)(nil)
+
+// NewPeerMetadata returns a peer metadata store persisted to store. Values are
+// gob encoded, so types other than the builtin ones must be registered with
+// gob.Register before being stored.
+func NewPeerMetadata(store Datastore) pstore.PeerMetadata {
+	return &dsPeerMetadata{ds: store}
+}
+
+func (pm *dsPeerMetadata) Get(p peer.ID, key string) (interface{}, error) {
+	data, err := pm.ds.Get(peerKey(metadataPrefix, p) + "/" + key)
+	if err == ErrNotFound {
+		return nil, pstore.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var res interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (pm *dsPeerMetadata) Put(p peer.ID, key string, val interface{}) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&val); err != nil {
+		return err
+	}
+	return pm.ds.Put(peerKey(metadataPrefix, p)+"/"+key, buf.Bytes())
+}
+
+// RemovePeer deletes the metadata of p
+func (pm *dsPeerMetadata) RemovePeer(p peer.ID) {
+	prefix := peerKey(metadataPrefix, p) + "/"
+	_ = pm.ds.Query(prefix, func(key string, _ []byte) error {
+		return pm.ds.Delete(key)
+	})
+}
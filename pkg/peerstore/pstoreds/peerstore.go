@@ -0,0 +1,104 @@
+// Package pstoreds provides a peerstore persisted to a pluggable key-value
+// Datastore, with FileDatastore as the embedded file-based default. Address
+// TTLs, and the AddrStream behaviour, match those of pstoremem.
+package pstoreds
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	pstoreimpl "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	"go.uber.org/zap"
+)
+
+// key prefixes of the records written to the datastore, followed by the b58
+// encoded id of their peer
+const (
+	addrsPrefix    = "/peers/addrs/"
+	keysPrefix     = "/peers/keys/"
+	protosPrefix   = "/peers/protos/"
+	metadataPrefix = "/peers/metadata/"
+)
+
+func peerKey(prefix string, p peer.ID) string {
+	return prefix + peer.IDB58Encode(p)
+}
+
+// peerFromKey decodes the peer a key written by peerKey belongs to, ignoring
+// any suffix following the peer id
+func peerFromKey(prefix, key string) (peer.ID, error) {
+	s := strings.TrimPrefix(key, prefix)
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		s = s[:i]
+	}
+	return peer.IDB58Decode(s)
+}
+
+// Options configures a persistent peerstore
+type Options struct {
+	// CacheSize is the number of peers whose address records are kept in
+	// the read-through cache. Zero disables the cache.
+	CacheSize uint
+	// GCInterval is the interval at which expired addresses are purged
+	// from the datastore. Zero disables the garbage collection.
+	GCInterval time.Duration
+}
+
+// DefaultOpts returns the default options for a persistent peerstore
+func DefaultOpts() Options {
+	return Options{
+		CacheSize:  1024,
+		GCInterval: time.Hour,
+	}
+}
+
+// NewPeerstore creates a peerstore persisted to store. Closing the peerstore
+// leaves store open.
+func NewPeerstore(ctx context.Context, logger *zap.Logger, store Datastore, opts Options) (pstore.Peerstore, error) {
+	ab, err := NewAddrBook(ctx, logger, store, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pstoreimpl.NewPeerstore(
+		ctx,
+		NewKeyBook(logger, store),
+		ab,
+		NewProtoBook(store),
+		NewPeerMetadata(store)), nil
+}
+
+// NewFilePeerstore creates a peerstore persisted to a FileDatastore at path,
+// which is closed along with the peerstore.
+func NewFilePeerstore(ctx context.Context, logger *zap.Logger, path string, opts Options) (pstore.Peerstore, error) {
+	store, err := NewFileDatastore(path)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := NewPeerstore(ctx, logger, store, opts)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return &filePeerstore{BoundedPeerstore: ps.(pstoreimpl.BoundedPeerstore), store: store}, nil
+}
+
+type filePeerstore struct {
+	pstoreimpl.BoundedPeerstore
+	store *FileDatastore
+}
+
+// UnwrapAddrBook returns the peerstore wrapped around the datastore books
+func (ps *filePeerstore) UnwrapAddrBook() pstore.AddrBook {
+	return ps.BoundedPeerstore
+}
+
+func (ps *filePeerstore) Close() error {
+	err := ps.BoundedPeerstore.Close()
+	if serr := ps.store.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
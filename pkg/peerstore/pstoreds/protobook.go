@@ -0,0 +1,154 @@
+package pstoreds
+
+import (
+	"encoding/binary"
+	"sync"
+
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+)
+
+type dsProtoBook struct {
+	ds Datastore
+
+	// guard the read-modify-write cycles on the protocol sets, sharded by peer
+	locks [256]sync.RWMutex
+}
+
+var _ pstore.ProtoBook = (*dsProtoBook)(nil)
+
+// NewProtoBook returns a protocol book persisted to store
+func NewProtoBook(store Datastore) pstore.ProtoBook {
+	return &dsProtoBook{ds: store}
+}
+
+func (pb *dsProtoBook) lock(p peer.ID) *sync.RWMutex {
+	return &pb.locks[byte(p[len(p)-1])]
+}
+
+// load returns the protocol set of p. Must be called with the lock of p held.
+func (pb *dsProtoBook) load(p peer.ID) (map[string]struct{}, error) {
+	data, err := pb.ds.Get(peerKey(protosPrefix, p))
+	if err == ErrNotFound {
+		return make(map[string]struct{}), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	protos := make(map[string]struct{})
+	for len(data) > 0 {
+		l, n := binary.Uvarint(data)
+		if n <= 0 || l > uint64(len(data)-n) {
+			return nil, errCorruptRecord
+		}
+		protos[string(data[n:n+int(l)])] = struct{}{}
+		data = data[n+int(l):]
+	}
+	return protos, nil
+}
+
+// store writes the protocol set of p as a sequence of uvarint length prefixed
+// protocols. Must be called with the write lock of p held.
+func (pb *dsProtoBook) store(p peer.ID, protos map[string]struct{}) error {
+	if len(protos) == 0 {
+		return pb.ds.Delete(peerKey(protosPrefix, p))
+	}
+	var (
+		buf  []byte
+		vbuf [binary.MaxVarintLen64]byte
+	)
+	for proto := range protos {
+		buf = append(buf, vbuf[:binary.PutUvarint(vbuf[:], uint64(len(proto)))]...)
+		buf = append(buf, proto...)
+	}
+	return pb.ds.Put(peerKey(protosPrefix, p), buf)
+}
+
+func (pb *dsProtoBook) SetProtocols(p peer.ID, protos ...string) error {
+	lk := pb.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	newprotos := make(map[string]struct{}, len(protos))
+	for _, proto := range protos {
+		newprotos[proto] = struct{}{}
+	}
+	return pb.store(p, newprotos)
+}
+
+func (pb *dsProtoBook) AddProtocols(p peer.ID, protos ...string) error {
+	lk := pb.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	protomap, err := pb.load(p)
+	if err != nil {
+		return err
+	}
+	for _, proto := range protos {
+		protomap[proto] = struct{}{}
+	}
+	return pb.store(p, protomap)
+}
+
+func (pb *dsProtoBook) GetProtocols(p peer.ID) ([]string, error) {
+	lk := pb.lock(p)
+	lk.RLock()
+	defer lk.RUnlock()
+
+	protomap, err := pb.load(p)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(protomap))
+	for k := range protomap {
+		out = append(out, k)
+	}
+	return out, nil
+}
+
+func (pb *dsProtoBook) RemoveProtocols(p peer.ID, protos ...string) error {
+	lk := pb.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+
+	protomap, err := pb.load(p)
+	if err != nil {
+		return err
+	}
+	if len(protomap) == 0 {
+		// nothing to remove.
+		return nil
+	}
+	for _, proto := range protos {
+		delete(protomap, proto)
+	}
+	return pb.store(p, protomap)
+}
+
+func (pb *dsProtoBook) SupportsProtocols(p peer.ID, protos ...string) ([]string, error) {
+	lk := pb.lock(p)
+	lk.RLock()
+	defer lk.RUnlock()
+
+	protomap, err := pb.load(p)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(protos))
+	for _, proto := range protos {
+		if _, ok := protomap[proto]; ok {
+			out = append(out, proto)
+		}
+	}
+	return out, nil
+}
+
+// RemovePeer deletes the protocols of p
+func (pb *dsProtoBook) RemovePeer(p peer.ID) {
+	lk := pb.lock(p)
+	lk.Lock()
+	defer lk.Unlock()
+	// a failed delete only leaves a stale protocol set behind
+	_ = pb.ds.Delete(peerKey(protosPrefix, p))
+}
@@ -2,6 +2,7 @@ package pstoremem
 
 import (
 	"context"
+	"errors"
 	"sort"
 	"sync"
 	"time"
@@ -10,9 +11,15 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 
 	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	pstoreimpl "github.com/RTradeLtd/libp2px/pkg/peerstore"
 	addr "github.com/RTradeLtd/libp2px/pkg/peerstore/addr"
+	"github.com/RTradeLtd/libp2px/pkg/record"
 )
 
+// ErrNotPeerRecord is returned by ConsumePeerRecord for envelopes that don't
+// contain a peer record
+var ErrNotPeerRecord = errors.New("envelope did not contain a peer record")
+
 type expiringAddr struct {
 	Addr    ma.Multiaddr
 	TTL     time.Duration
@@ -32,6 +39,16 @@ type addrSegment struct {
 	// space unused. storing the *values* directly in the map will
 	// drastically increase the space waste. In our case, by 6x.
 	addrs map[peer.ID]map[string]*expiringAddr
+
+	// latest signed peer record of each peer
+	signedPeerRecords map[peer.ID]*peerRecordState
+}
+
+// peerRecordState is the latest signed peer record accepted for a peer
+type peerRecordState struct {
+	Envelope *record.Envelope
+	Seq      uint64
+	Addrs    []ma.Multiaddr
 }
 
 func (s *addrSegments) get(p peer.ID) *addrSegment {
@@ -49,6 +66,7 @@ type memoryAddrBook struct {
 }
 
 var _ pstore.AddrBook = (*memoryAddrBook)(nil)
+var _ pstoreimpl.CertifiedAddrBook = (*memoryAddrBook)(nil)
 
 // NewAddrBook returns a new in-memory addrbook
 func NewAddrBook(ctx context.Context) pstore.AddrBook {
@@ -57,7 +75,10 @@ func NewAddrBook(ctx context.Context) pstore.AddrBook {
 	ab := &memoryAddrBook{
 		segments: func() (ret addrSegments) {
 			for i := range ret {
-				ret[i] = &addrSegment{addrs: make(map[peer.ID]map[string]*expiringAddr)}
+				ret[i] = &addrSegment{
+					addrs:             make(map[peer.ID]map[string]*expiringAddr),
+					signedPeerRecords: make(map[peer.ID]*peerRecordState),
+				}
 			}
 			return ret
 		}(),
@@ -106,9 +127,13 @@ func (mab *memoryAddrBook) gc() {
 				delete(s.addrs, p)
 			}
 		}
+		for p := range s.signedPeerRecords {
+			if !s.hasCertifiedAddrs(p, now) {
+				delete(s.signedPeerRecords, p)
+			}
+		}
 		s.Unlock()
 	}
-
 }
 
 func (mab *memoryAddrBook) PeersWithAddrs() peer.IDSlice {
@@ -131,6 +156,8 @@ func (mab *memoryAddrBook) AddAddr(p peer.ID, addr ma.Multiaddr, ttl time.Durati
 // AddAddrs gives memoryAddrBook addresses to use, with a given ttl
 // (time-to-live), after which the address is no longer valid.
 // This function never reduces the TTL or expiration of an address.
+// Peers with a valid signed peer record only get the addresses they
+// certified, the ones learned from third parties being ignored.
 func (mab *memoryAddrBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Duration) {
 	// if ttl is zero, exit. nothing to do.
 	if ttl <= 0 {
@@ -141,16 +168,25 @@ func (mab *memoryAddrBook) AddAddrs(p peer.ID, addrs []ma.Multiaddr, ttl time.Du
 	s.Lock()
 	defer s.Unlock()
 
+	now := time.Now()
+	var certified []ma.Multiaddr
+	if s.hasCertifiedAddrs(p, now) {
+		certified = s.signedPeerRecords[p].Addrs
+	}
+
 	amap := s.addrs[p]
 	if amap == nil {
 		amap = make(map[string]*expiringAddr, len(addrs))
 		s.addrs[p] = amap
 	}
-	exp := time.Now().Add(ttl)
+	exp := now.Add(ttl)
 	for _, addr := range addrs {
 		if addr == nil {
 			continue
 		}
+		if certified != nil && !containsAddr(certified, addr) {
+			continue
+		}
 		asBytes := addr.Bytes()
 		a, found := amap[string(asBytes)] // won't allocate.
 		if !found {
@@ -256,6 +292,106 @@ func (mab *memoryAddrBook) ClearAddrs(p peer.ID) {
 	defer s.Unlock()
 
 	delete(s.addrs, p)
+	delete(s.signedPeerRecords, p)
+}
+
+// ConsumePeerRecord validates a signed peer record and stores its addresses
+// for ttl. Addresses of the previous record of the peer that are missing from
+// the new one are removed, while addresses learned from third parties are
+// kept. Records whose sequence number isn't greater than the one of the
+// stored record are ignored.
+func (mab *memoryAddrBook) ConsumePeerRecord(env *record.Envelope, ttl time.Duration) (bool, error) {
+	if err := env.Validate(record.PeerRecordEnvelopeDomain); err != nil {
+		return false, err
+	}
+	r, err := env.Record()
+	if err != nil {
+		return false, err
+	}
+	rec, ok := r.(*record.PeerRecord)
+	if !ok {
+		return false, ErrNotPeerRecord
+	}
+	if !rec.PeerID.MatchesPublicKey(env.PublicKey) {
+		return false, record.ErrSignerMismatch
+	}
+
+	p := rec.PeerID
+	s := mab.segments.get(p)
+	s.Lock()
+	defer s.Unlock()
+
+	if prev, ok := s.signedPeerRecords[p]; ok {
+		if rec.Seq <= prev.Seq {
+			return false, nil
+		}
+		// forget the addresses the peer no longer certifies
+		if amap := s.addrs[p]; amap != nil {
+			for _, a := range prev.Addrs {
+				if !containsAddr(rec.Addrs, a) {
+					delete(amap, string(a.Bytes()))
+				}
+			}
+		}
+	}
+	s.signedPeerRecords[p] = &peerRecordState{Envelope: env, Seq: rec.Seq, Addrs: rec.Addrs}
+
+	if ttl <= 0 {
+		return true, nil
+	}
+	amap := s.addrs[p]
+	if amap == nil {
+		amap = make(map[string]*expiringAddr, len(rec.Addrs))
+		s.addrs[p] = amap
+	}
+	exp := time.Now().Add(ttl)
+	for _, a := range rec.Addrs {
+		key := string(a.Bytes())
+		if _, found := amap[key]; !found {
+			mab.subManager.BroadcastAddr(p, a)
+		}
+		amap[key] = &expiringAddr{Addr: a, Expires: exp, TTL: ttl}
+	}
+	return true, nil
+}
+
+// GetPeerRecord returns the latest signed record of p, or nil if there is none
+// or all of its addresses have expired.
+func (mab *memoryAddrBook) GetPeerRecord(p peer.ID) *record.Envelope {
+	s := mab.segments.get(p)
+	s.RLock()
+	defer s.RUnlock()
+
+	state, ok := s.signedPeerRecords[p]
+	if !ok || !s.hasCertifiedAddrs(p, time.Now()) {
+		return nil
+	}
+	return state.Envelope
+}
+
+// hasCertifiedAddrs returns whether any address of the signed record of p is
+// still valid. Must be called with the segment lock held.
+func (s *addrSegment) hasCertifiedAddrs(p peer.ID, now time.Time) bool {
+	state, ok := s.signedPeerRecords[p]
+	if !ok {
+		return false
+	}
+	amap := s.addrs[p]
+	for _, a := range state.Addrs {
+		if ea, ok := amap[string(a.Bytes())]; ok && !ea.ExpiredBy(now) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAddr(addrs []ma.Multiaddr, a ma.Multiaddr) bool {
+	for _, b := range addrs {
+		if a.Equal(b) {
+			return true
+		}
+	}
+	return false
 }
 
 // AddrStream returns a channel on which all new addresses discovered for a
@@ -0,0 +1,89 @@
+package pstoremem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/test"
+	pstore "github.com/RTradeLtd/libp2px/pkg/peerstore"
+	"github.com/RTradeLtd/libp2px/pkg/record"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestCertifiedAddrBook(t *testing.T) {
+	ps := NewPeerstore(context.Background())
+	defer ps.Close()
+	cab, ok := pstore.GetCertifiedAddrBook(ps)
+	if !ok {
+		t.Fatal("in-memory peerstore should have a certified address book")
+	}
+
+	sk, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := peer.IDFromPrivateKey(sk)
+	a1 := ma.StringCast("/ip4/1.1.1.1/tcp/1")
+	a2 := ma.StringCast("/ip4/2.2.2.2/tcp/2")
+	rumour := ma.StringCast("/ip4/3.3.3.3/tcp/3")
+
+	sign := func(addrs ...ma.Multiaddr) *record.Envelope {
+		t.Helper()
+		env, err := record.PeerRecordFromAddrInfo(peer.AddrInfo{ID: p, Addrs: addrs}).Sign(sk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+
+	ps.AddAddr(p, rumour, time.Hour)
+	old := sign(a1)
+	newer := sign(a2)
+
+	if accepted, err := cab.ConsumePeerRecord(newer, time.Hour); err != nil || !accepted {
+		t.Fatalf("expected record to be accepted, got %v %v", accepted, err)
+	}
+	if accepted, err := cab.ConsumePeerRecord(old, time.Hour); err != nil || accepted {
+		t.Fatalf("expected stale record to be ignored, got %v %v", accepted, err)
+	}
+	if addrs := ps.Addrs(p); len(addrs) != 2 {
+		t.Fatalf("expected the certified and uncertified addresses, got %v", addrs)
+	}
+	if !cab.GetPeerRecord(p).Equal(newer) {
+		t.Fatal("unexpected peer record")
+	}
+
+	// uncertified addresses are ignored once the peer has a record
+	ps.AddAddr(p, ma.StringCast("/ip4/4.4.4.4/tcp/4"), time.Hour)
+	if addrs := ps.Addrs(p); len(addrs) != 2 {
+		t.Fatalf("expected the uncertified address to be ignored, got %v", addrs)
+	}
+
+	// a newer record replaces the certified addresses only
+	if accepted, err := cab.ConsumePeerRecord(sign(a1), time.Hour); err != nil || !accepted {
+		t.Fatalf("expected record to be accepted, got %v %v", accepted, err)
+	}
+	addrs := ps.Addrs(p)
+	if len(addrs) != 2 || containsAddr(addrs, a2) || !containsAddr(addrs, rumour) {
+		t.Fatalf("expected %s to be replaced, got %v", a2, addrs)
+	}
+
+	// a record of another peer is refused
+	osk, _, _ := test.RandTestKeyPair(crypto.Ed25519, 256)
+	forged, err := record.Seal(&record.PeerRecord{PeerID: p, Seq: record.TimestampSeq(), Addrs: []ma.Multiaddr{rumour}}, osk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cab.ConsumePeerRecord(forged, time.Hour); err != record.ErrSignerMismatch {
+		t.Fatalf("expected %v, got %v", record.ErrSignerMismatch, err)
+	}
+
+	ps.ClearAddrs(p)
+	if cab.GetPeerRecord(p) != nil {
+		t.Fatal("record should be dropped along with the addresses")
+	}
+}
@@ -0,0 +1,85 @@
+package pstoremem
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	pi "github.com/RTradeLtd/libp2px-core/peerstore"
+	"github.com/RTradeLtd/libp2px-core/test"
+	pstore "github.com/RTradeLtd/libp2px/pkg/peerstore"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func TestPeerstoreEviction(t *testing.T) {
+	ps := NewPeerstore(context.Background()).(pstore.BoundedPeerstore)
+	defer ps.Close()
+
+	// the local peer is never evicted
+	sk, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, _ := peer.IDFromPrivateKey(sk)
+	if err := ps.AddPrivKey(self, sk); err != nil {
+		t.Fatal(err)
+	}
+
+	var peers []peer.ID
+	for i := 0; i < 6; i++ {
+		p, err := test.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		peers = append(peers, p)
+	}
+	kept := peers[0]
+	ps.SetEvictionFilter(func(p peer.ID) bool { return p == kept })
+	// the local and kept peers leave room for two others
+	ps.SetMaxPeers(4)
+
+	addr := ma.StringCast("/ip4/1.2.3.4/tcp/1")
+	for _, p := range peers {
+		ps.AddAddr(p, addr, time.Hour)
+		if err := ps.Put(p, "key", "value"); err != nil {
+			t.Fatal(err)
+		}
+		if err := ps.AddProtocols(p, "/proto"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := ps.Evictions(); n != 3 {
+		t.Fatalf("expected 3 evictions, got %d", n)
+	}
+	for _, p := range []peer.ID{self, kept, peers[4], peers[5]} {
+		if ps.PubKey(p) == nil && len(ps.Addrs(p)) == 0 {
+			t.Fatalf("peer %s was evicted", p)
+		}
+	}
+	for _, p := range peers[1:4] {
+		if len(ps.Addrs(p)) != 0 {
+			t.Fatalf("addresses of evicted peer %s were kept", p)
+		}
+		if _, err := ps.Get(p, "key"); err != pi.ErrNotFound {
+			t.Fatalf("metadata of evicted peer %s was kept", p)
+		}
+		if protos, _ := ps.GetProtocols(p); len(protos) != 0 {
+			t.Fatalf("protocols of evicted peer %s were kept", p)
+		}
+	}
+
+	ps.RemovePeer(peers[5])
+	if len(ps.Addrs(peers[5])) != 0 {
+		t.Fatal("addresses of removed peer were kept")
+	}
+	if _, err := ps.Get(peers[5], "key"); err != pi.ErrNotFound {
+		t.Fatal("metadata of removed peer was kept")
+	}
+	if n := ps.Evictions(); n != 3 {
+		t.Fatalf("removing a peer counted as an eviction, got %d", n)
+	}
+}
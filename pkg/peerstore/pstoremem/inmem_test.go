@@ -0,0 +1,30 @@
+package pstoremem
+
+import (
+	"context"
+	"testing"
+
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	pt "github.com/RTradeLtd/libp2px/pkg/peerstore/test"
+)
+
+func TestInMemoryPeerstore(t *testing.T) {
+	pt.TestPeerstore(t, func() (pstore.Peerstore, func()) {
+		ps := NewPeerstore(context.Background())
+		return ps, func() { ps.Close() }
+	})
+}
+
+func TestInMemoryAddrBook(t *testing.T) {
+	pt.TestAddrBook(t, func() (pstore.AddrBook, func()) {
+		ps := NewPeerstore(context.Background())
+		return ps, func() { ps.Close() }
+	})
+}
+
+func TestInMemoryKeyBook(t *testing.T) {
+	pt.TestKeyBook(t, func() (pstore.KeyBook, func()) {
+		ps := NewPeerstore(context.Background())
+		return ps, func() { ps.Close() }
+	})
+}
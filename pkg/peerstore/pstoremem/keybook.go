@@ -91,3 +91,11 @@ func (mkb *memoryKeyBook) AddPrivKey(p peer.ID, sk ic.PrivKey) error {
 	mkb.Unlock()
 	return nil
 }
+
+// RemovePeer forgets the keys of p
+func (mkb *memoryKeyBook) RemovePeer(p peer.ID) {
+	mkb.Lock()
+	delete(mkb.pks, p)
+	delete(mkb.sks, p)
+	mkb.Unlock()
+}
@@ -12,15 +12,10 @@ var internKeys = map[string]bool{
 	"ProtocolVersion": true,
 }
 
-type metakey struct {
-	id  peer.ID
-	key string
-}
-
 type memoryPeerMetadata struct {
 	// store other data, like versions
 	//ds ds.ThreadSafeDatastore
-	ds       map[metakey]interface{}
+	ds       map[peer.ID]map[string]interface{}
 	dslock   sync.RWMutex
 	interned map[string]interface{}
 }
@@ -30,7 +25,7 @@ var _ pstore.PeerMetadata = (*memoryPeerMetadata)(nil)
 // NewPeerMetadata returns a new peer metadata storer
 func NewPeerMetadata() pstore.PeerMetadata {
 	return &memoryPeerMetadata{
-		ds:       make(map[metakey]interface{}),
+		ds:       make(map[peer.ID]map[string]interface{}),
 		interned: make(map[string]interface{}),
 	}
 }
@@ -45,16 +40,28 @@ func (ps *memoryPeerMetadata) Put(p peer.ID, key string, val interface{}) error
 			ps.interned[vals] = val
 		}
 	}
-	ps.ds[metakey{p, key}] = val
+	m, ok := ps.ds[p]
+	if !ok {
+		m = make(map[string]interface{})
+		ps.ds[p] = m
+	}
+	m[key] = val
 	return nil
 }
 
 func (ps *memoryPeerMetadata) Get(p peer.ID, key string) (interface{}, error) {
 	ps.dslock.RLock()
 	defer ps.dslock.RUnlock()
-	i, ok := ps.ds[metakey{p, key}]
+	i, ok := ps.ds[p][key]
 	if !ok {
 		return nil, pstore.ErrNotFound
 	}
 	return i, nil
 }
+
+// RemovePeer forgets the metadata of p
+func (ps *memoryPeerMetadata) RemovePeer(p peer.ID) {
+	ps.dslock.Lock()
+	delete(ps.ds, p)
+	ps.dslock.Unlock()
+}
@@ -0,0 +1,345 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+)
+
+// AddrBookFactory returns a fresh AddrBook and a function closing it
+type AddrBookFactory func() (pstore.AddrBook, func())
+
+var addressBookSuite = map[string]func(book AddrBookFactory) func(*testing.T){
+	"AddAddress":           testAddAddress,
+	"Clear":                testClearWorks,
+	"SetNegativeTTLClears": testSetNegativeTTLClears,
+	"UpdateTTLs":           testUpdateTTLs,
+	"NilAddrsDontBreak":    testNilAddrsDontBreak,
+	"AddressesExpire":      testAddressesExpire,
+	"ClearWithIter":        testClearWithIterator,
+	"PeersWithAddresses":   testPeersWithAddrs,
+}
+
+// TestAddrBook runs the address book suite against the books built by factory
+func TestAddrBook(t *testing.T, factory AddrBookFactory) {
+	for name, test := range addressBookSuite {
+		t.Run(name, test(factory))
+	}
+}
+
+func testAddAddress(ab AddrBookFactory) func(*testing.T) {
+	return func(t *testing.T) {
+		t.Run("add a single address", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(1)
+
+			m.AddAddr(id, addrs[0], time.Hour)
+
+			assertAddrsEqual(t, addrs, m.Addrs(id))
+		})
+
+		t.Run("idempotent add single address", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(1)
+
+			m.AddAddr(id, addrs[0], time.Hour)
+			m.AddAddr(id, addrs[0], time.Hour)
+
+			assertAddrsEqual(t, addrs, m.Addrs(id))
+		})
+
+		t.Run("add multiple addresses", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(3)
+
+			m.AddAddrs(id, addrs, time.Hour)
+			assertAddrsEqual(t, addrs, m.Addrs(id))
+		})
+
+		t.Run("idempotent add multiple addresses", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(3)
+
+			m.AddAddrs(id, addrs, time.Hour)
+			m.AddAddrs(id, addrs, time.Hour)
+
+			assertAddrsEqual(t, addrs, m.Addrs(id))
+		})
+
+		t.Run("adding an existing address with a later expiration extends its ttl", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(3)
+
+			m.AddAddrs(id, addrs, time.Second)
+
+			// same address as before but with a higher TTL
+			m.AddAddrs(id, addrs[2:], time.Hour)
+
+			// after the initial TTL has expired, check that only the third address is present.
+			time.Sleep(1200 * time.Millisecond)
+			assertAddrsEqual(t, addrs[2:], m.Addrs(id))
+		})
+
+		t.Run("adding an existing address with an earlier expiration is a noop", func(t *testing.T) {
+			m, closeFunc := ab()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+			addrs := generateAddrs(3)
+
+			m.AddAddrs(id, addrs, time.Hour)
+
+			// same address as before but with a lower TTL
+			m.AddAddrs(id, addrs[2:], time.Second)
+
+			// after the initial TTL has expired, check that all three addresses are still present (i.e. the TTL on
+			// the modified one was not shortened).
+			time.Sleep(2100 * time.Millisecond)
+			assertAddrsEqual(t, addrs, m.Addrs(id))
+		})
+	}
+}
+
+func testClearWorks(ab AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		m, closeFunc := ab()
+		defer closeFunc()
+
+		ids := generatePeerIds(t, 2)
+		addrs := generateAddrs(5)
+
+		m.AddAddrs(ids[0], addrs[0:3], time.Hour)
+		m.AddAddrs(ids[1], addrs[3:], time.Hour)
+
+		assertAddrsEqual(t, addrs[0:3], m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs[3:], m.Addrs(ids[1]))
+
+		m.ClearAddrs(ids[0])
+		assertAddrsEqual(t, nil, m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs[3:], m.Addrs(ids[1]))
+
+		m.ClearAddrs(ids[1])
+		assertAddrsEqual(t, nil, m.Addrs(ids[0]))
+		assertAddrsEqual(t, nil, m.Addrs(ids[1]))
+	}
+}
+
+func testSetNegativeTTLClears(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		m, closeFunc := m()
+		defer closeFunc()
+
+		id := generatePeerIds(t, 1)[0]
+		addrs := generateAddrs(100)
+
+		m.SetAddrs(id, addrs, time.Hour)
+		assertAddrsEqual(t, addrs, m.Addrs(id))
+
+		// remove two addresses.
+		m.SetAddr(id, addrs[50], -1)
+		m.SetAddr(id, addrs[75], -1)
+
+		// calculate the survivors
+		survivors := append(addrs[0:50], addrs[51:]...)
+		survivors = append(survivors[0:74], survivors[75:]...)
+
+		assertAddrsEqual(t, survivors, m.Addrs(id))
+	}
+}
+
+func testUpdateTTLs(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		t.Run("update ttl of peer with no addrs", func(t *testing.T) {
+			m, closeFunc := m()
+			defer closeFunc()
+
+			id := generatePeerIds(t, 1)[0]
+
+			// Shouldn't panic.
+			m.UpdateAddrs(id, time.Hour, time.Minute)
+		})
+
+		t.Run("update ttls successfully", func(t *testing.T) {
+			m, closeFunc := m()
+			defer closeFunc()
+
+			ids := generatePeerIds(t, 2)
+			addrs1, addrs2 := generateAddrs(2), generateAddrs(2)
+
+			// set two keys with different ttls for each peer.
+			m.SetAddr(ids[0], addrs1[0], time.Hour)
+			m.SetAddr(ids[0], addrs1[1], time.Minute)
+			m.SetAddr(ids[1], addrs2[0], time.Hour)
+			m.SetAddr(ids[1], addrs2[1], time.Minute)
+
+			// Sanity check.
+			assertAddrsEqual(t, addrs1, m.Addrs(ids[0]))
+			assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+			// Will only affect addrs1[0].
+			// Badger does not support subsecond TTLs.
+			// https://github.com/dgraph-io/badger/issues/339
+			m.UpdateAddrs(ids[0], time.Hour, 1*time.Second)
+
+			// No immediate effect.
+			assertAddrsEqual(t, addrs1, m.Addrs(ids[0]))
+			assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+			// After a wait, addrs[0] is gone.
+			time.Sleep(1500 * time.Millisecond)
+			assertAddrsEqual(t, addrs1[1:2], m.Addrs(ids[0]))
+			assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+			// Will only affect addrs2[0].
+			m.UpdateAddrs(ids[1], time.Hour, 1*time.Second)
+
+			// No immediate effect.
+			assertAddrsEqual(t, addrs1[1:2], m.Addrs(ids[0]))
+			assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+			time.Sleep(1500 * time.Millisecond)
+
+			// First addrs is gone in both.
+			assertAddrsEqual(t, addrs1[1:], m.Addrs(ids[0]))
+			assertAddrsEqual(t, addrs2[1:], m.Addrs(ids[1]))
+		})
+	}
+}
+
+func testNilAddrsDontBreak(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		m, closeFunc := m()
+		defer closeFunc()
+
+		id := generatePeerIds(t, 1)[0]
+
+		m.SetAddr(id, nil, time.Hour)
+		m.AddAddr(id, nil, time.Hour)
+	}
+}
+
+func testAddressesExpire(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		m, closeFunc := m()
+		defer closeFunc()
+
+		ids := generatePeerIds(t, 2)
+		addrs1 := generateAddrs(3)
+		addrs2 := generateAddrs(2)
+
+		m.AddAddrs(ids[0], addrs1, time.Hour)
+		m.AddAddrs(ids[1], addrs2, time.Hour)
+
+		assertAddrsEqual(t, addrs1, m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+		m.AddAddrs(ids[0], addrs1, 2*time.Hour)
+		m.AddAddrs(ids[1], addrs2, 2*time.Hour)
+
+		assertAddrsEqual(t, addrs1, m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+		m.SetAddr(ids[0], addrs1[0], 100*time.Microsecond)
+		<-time.After(100 * time.Millisecond)
+		assertAddrsEqual(t, addrs1[1:3], m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+		m.SetAddr(ids[0], addrs1[2], 100*time.Microsecond)
+		<-time.After(100 * time.Millisecond)
+		assertAddrsEqual(t, addrs1[1:2], m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs2, m.Addrs(ids[1]))
+
+		m.SetAddr(ids[1], addrs2[0], 100*time.Microsecond)
+		<-time.After(100 * time.Millisecond)
+		assertAddrsEqual(t, addrs1[1:2], m.Addrs(ids[0]))
+		assertAddrsEqual(t, addrs2[1:], m.Addrs(ids[1]))
+
+		m.SetAddr(ids[1], addrs2[1], 100*time.Microsecond)
+		<-time.After(100 * time.Millisecond)
+		assertAddrsEqual(t, addrs1[1:2], m.Addrs(ids[0]))
+		assertAddrsEqual(t, nil, m.Addrs(ids[1]))
+
+		m.SetAddr(ids[0], addrs1[1], 100*time.Microsecond)
+		<-time.After(100 * time.Millisecond)
+		assertAddrsEqual(t, nil, m.Addrs(ids[0]))
+		assertAddrsEqual(t, nil, m.Addrs(ids[1]))
+	}
+}
+
+func testClearWithIterator(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		m, closeFunc := m()
+		defer closeFunc()
+
+		ids := generatePeerIds(t, 2)
+		addrs := generateAddrs(100)
+
+		// Add the peers with 50 addresses each.
+		m.AddAddrs(ids[0], addrs[:50], pstore.PermanentAddrTTL)
+		m.AddAddrs(ids[1], addrs[50:], pstore.PermanentAddrTTL)
+
+		if all := append(m.Addrs(ids[0]), m.Addrs(ids[1])...); len(all) != 100 {
+			t.Fatal("expected pstore to contain both peers with all their maddrs")
+		}
+
+		// Since we don't fetch these peers, they won't be present in cache.
+
+		m.ClearAddrs(ids[0])
+		if all := append(m.Addrs(ids[0]), m.Addrs(ids[1])...); len(all) != 50 {
+			t.Fatal("expected pstore to contain only addrs of peer 2")
+		}
+
+		m.ClearAddrs(ids[1])
+		if all := append(m.Addrs(ids[0]), m.Addrs(ids[1])...); len(all) != 0 {
+			t.Fatal("expected pstore to contain no addresses")
+		}
+	}
+}
+
+func testPeersWithAddrs(m AddrBookFactory) func(t *testing.T) {
+	return func(t *testing.T) {
+		// cannot run in parallel as the store is modified.
+		// go runs sequentially in the specified order
+		// see https://blog.golang.org/subtests
+
+		t.Run("empty addrbook", func(t *testing.T) {
+			m, closeFunc := m()
+			defer closeFunc()
+
+			if peers := m.PeersWithAddrs(); len(peers) != 0 {
+				t.Fatal("expected to find no peers")
+			}
+		})
+
+		t.Run("non-empty addrbook", func(t *testing.T) {
+			m, closeFunc := m()
+			defer closeFunc()
+
+			ids := generatePeerIds(t, 2)
+			addrs := generateAddrs(10)
+
+			m.AddAddrs(ids[0], addrs[:5], pstore.PermanentAddrTTL)
+			m.AddAddrs(ids[1], addrs[5:], pstore.PermanentAddrTTL)
+
+			if peers := m.PeersWithAddrs(); len(peers) != 2 {
+				t.Fatal("expected to find 2 peers")
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package test
+
+import (
+	"sort"
+	"testing"
+
+	ic "github.com/RTradeLtd/libp2px-core/crypto"
+	peer "github.com/RTradeLtd/libp2px-core/peer"
+	pstore "github.com/RTradeLtd/libp2px-core/peerstore"
+	pt "github.com/RTradeLtd/libp2px-core/test"
+)
+
+// KeyBookFactory returns a fresh KeyBook and a function closing it
+type KeyBookFactory func() (pstore.KeyBook, func())
+
+var keyBookSuite = map[string]func(kb pstore.KeyBook) func(*testing.T){
+	"AddGetPrivKey":         testKeybookPrivKey,
+	"AddGetPubKey":          testKeyBookPubKey,
+	"PeersWithKeys":         testKeyBookPeers,
+	"PubKeyAddedOnRetrieve": testInlinedPubKeyAddedOnRetrieve,
+}
+
+// TestKeyBook runs the key book suite against the books built by factory
+func TestKeyBook(t *testing.T, factory KeyBookFactory) {
+	for name, test := range keyBookSuite {
+		kb, closeFunc := factory()
+		t.Run(name, test(kb))
+		if closeFunc != nil {
+			closeFunc()
+		}
+	}
+}
+
+func testKeybookPrivKey(kb pstore.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		if peers := kb.PeersWithKeys(); len(peers) > 0 {
+			t.Error("expected peers to be empty on init")
+		}
+
+		priv, _, err := pt.RandTestKeyPair(ic.RSA, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := peer.IDFromPrivateKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res := kb.PrivKey(id); res != nil {
+			t.Error("retrieving private key should have failed")
+		}
+
+		if err := kb.AddPrivKey(id, priv); err != nil {
+			t.Fatal(err)
+		}
+
+		if res := kb.PrivKey(id); !priv.Equals(res) {
+			t.Error("retrieved private key did not match stored private key")
+		}
+
+		if peers := kb.PeersWithKeys(); len(peers) != 1 || peers[0] != id {
+			t.Error("list of peers did not include test peer")
+		}
+	}
+}
+
+func testKeyBookPubKey(kb pstore.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		if peers := kb.PeersWithKeys(); len(peers) > 0 {
+			t.Error("expected peers to be empty on init")
+		}
+
+		_, pub, err := pt.RandTestKeyPair(ic.RSA, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := peer.IDFromPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res := kb.PubKey(id); res != nil {
+			t.Error("retrieving public key should have failed")
+		}
+
+		if err := kb.AddPubKey(id, pub); err != nil {
+			t.Fatal(err)
+		}
+
+		if res := kb.PubKey(id); !pub.Equals(res) {
+			t.Error("retrieved public key did not match stored public key")
+		}
+
+		if peers := kb.PeersWithKeys(); len(peers) != 1 || peers[0] != id {
+			t.Error("list of peers did not include test peer")
+		}
+	}
+}
+
+func testKeyBookPeers(kb pstore.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		if peers := kb.PeersWithKeys(); len(peers) > 0 {
+			t.Fatal("expected peers to be empty on init")
+		}
+
+		var peers peer.IDSlice
+		for i := 0; i < 10; i++ {
+			// Add a public key.
+			_, pub, _ := pt.RandTestKeyPair(ic.Ed25519, 256)
+			p1, _ := peer.IDFromPublicKey(pub)
+			if err := kb.AddPubKey(p1, pub); err != nil {
+				t.Fatal(err)
+			}
+
+			// Add a private key.
+			priv, _, _ := pt.RandTestKeyPair(ic.Ed25519, 256)
+			p2, _ := peer.IDFromPrivateKey(priv)
+			if err := kb.AddPrivKey(p2, priv); err != nil {
+				t.Fatal(err)
+			}
+
+			peers = append(peers, []peer.ID{p1, p2}...)
+		}
+
+		kbPeers := kb.PeersWithKeys()
+		sort.Sort(kbPeers)
+		sort.Sort(peers)
+
+		for i, p := range kbPeers {
+			if p != peers[i] {
+				t.Errorf("mismatch of peer at index %d", i)
+			}
+		}
+	}
+}
+
+func testInlinedPubKeyAddedOnRetrieve(kb pstore.KeyBook) func(t *testing.T) {
+	return func(t *testing.T) {
+		if peers := kb.PeersWithKeys(); len(peers) > 0 {
+			t.Fatal("expected peers to be empty on init")
+		}
+
+		// Key small enough for inlining.
+		_, pub, err := ic.GenerateKeyPair(ic.Ed25519, 256)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		id, err := peer.IDFromPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pubKey := kb.PubKey(id)
+		if !pubKey.Equals(pub) {
+			t.Error("mismatch between original public key and keybook-calculated one")
+		}
+	}
+}
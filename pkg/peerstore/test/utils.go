@@ -0,0 +1,62 @@
+// Package test contains the test suites every peerstore implementation must pass
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/RTradeLtd/libp2px-core/peer"
+	pt "github.com/RTradeLtd/libp2px-core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func multiaddr(m string) ma.Multiaddr {
+	maddr, err := ma.NewMultiaddr(m)
+	if err != nil {
+		panic(err)
+	}
+	return maddr
+}
+
+func generateAddrs(count int) []ma.Multiaddr {
+	var addrs = make([]ma.Multiaddr, count)
+	for i := 0; i < count; i++ {
+		addrs[i] = multiaddr(fmt.Sprintf("/ip4/1.1.1.%d/tcp/1111", i))
+	}
+	return addrs
+}
+
+func generatePeerIds(t *testing.T, count int) []peer.ID {
+	var ids = make([]peer.ID, count)
+	for i := 0; i < count; i++ {
+		id, err := pt.RandPeerID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func assertAddrsEqual(t *testing.T, exp, act []ma.Multiaddr) {
+	t.Helper()
+	if len(exp) != len(act) {
+		t.Fatalf("lengths not the same. expected %d, got %d\n", len(exp), len(act))
+	}
+
+	for _, a := range exp {
+		found := false
+
+		for _, b := range act {
+			if a.Equal(b) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			t.Fatalf("expected address %s not found", a)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package ping
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/libp2px-core/host"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	pool "github.com/RTradeLtd/libp2px/pkg/buffer-pool"
+	"go.uber.org/zap"
+)
+
+const (
+	// PingSize is the size of a single ping payload
+	PingSize = 32
+	// ID is the protocol.ID of the ping service
+	ID = "/ipfs/ping/1.0.0"
+
+	pingTimeout = time.Second * 60
+)
+
+var (
+	// DefaultProbeConcurrency is the number of peers the background prober
+	// pings at the same time
+	DefaultProbeConcurrency = 16
+	// DefaultProbeTimeout bounds the time the background prober waits on a
+	// single ping
+	DefaultProbeTimeout = 10 * time.Second
+)
+
+// ErrPingMismatch is returned when a peer echoes back a different payload than we sent
+var ErrPingMismatch = errors.New("ping packet was incorrect")
+
+// Result is the outcome of a single ping
+type Result struct {
+	RTT   time.Duration
+	Error error
+}
+
+// PingService answers pings from remote peers, and optionally probes the
+// peers we are connected to in the background, recording the measured round
+// trip times into the peerstore metrics.
+type PingService struct {
+	Host host.Host
+
+	probeInterval    time.Duration
+	probeConcurrency int
+	probeTimeout     time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	logger *zap.Logger
+}
+
+// Option is used to configure the ping service
+type Option func(ps *PingService) error
+
+// WithProber enables the background prober, pinging every connected peer
+// once per interval.
+func WithProber(interval time.Duration) Option {
+	return func(ps *PingService) error {
+		if interval <= 0 {
+			return errors.New("probe interval must be positive")
+		}
+		ps.probeInterval = interval
+		return nil
+	}
+}
+
+// WithProbeConcurrency sets the number of peers probed at the same time.
+// Defaults to DefaultProbeConcurrency.
+func WithProbeConcurrency(n int) Option {
+	return func(ps *PingService) error {
+		if n <= 0 {
+			return errors.New("probe concurrency must be positive")
+		}
+		ps.probeConcurrency = n
+		return nil
+	}
+}
+
+// NewPingService constructs a new *PingService and attaches its stream
+// handler to the given host.
+func NewPingService(ctx context.Context, h host.Host, logger *zap.Logger, opts ...Option) (*PingService, error) {
+	ps := &PingService{
+		Host:             h,
+		probeConcurrency: DefaultProbeConcurrency,
+		probeTimeout:     DefaultProbeTimeout,
+		logger:           logger.Named("ping"),
+	}
+	for _, opt := range opts {
+		if err := opt(ps); err != nil {
+			return nil, err
+		}
+	}
+	ps.ctx, ps.cancel = context.WithCancel(ctx)
+
+	h.SetStreamHandler(ID, ps.PingHandler)
+	if ps.probeInterval > 0 {
+		ps.wg.Add(1)
+		go ps.probe()
+	}
+	return ps, nil
+}
+
+// Close removes the ping handler and stops the background prober
+func (ps *PingService) Close() error {
+	ps.cancel()
+	ps.Host.RemoveStreamHandler(ID)
+	ps.wg.Wait()
+	return nil
+}
+
+// PingHandler echoes back every ping payload received on the stream
+func (ps *PingService) PingHandler(s network.Stream) {
+	buf := pool.Get(PingSize)
+	defer pool.Put(buf)
+
+	errCh := make(chan error, 1)
+	defer close(errCh)
+	timer := time.NewTimer(pingTimeout)
+	defer timer.Stop()
+
+	go func() {
+		select {
+		case <-timer.C:
+			ps.logger.Debug("ping timeout", zap.String("peer.id", s.Conn().RemotePeer().String()))
+		case err, ok := <-errCh:
+			if ok {
+				ps.logger.Debug("ping failed", zap.Error(err), zap.String("peer.id", s.Conn().RemotePeer().String()))
+			}
+		}
+		s.Reset()
+	}()
+
+	for {
+		_, err := io.ReadFull(s, buf)
+		if err != nil {
+			errCh <- err
+			return
+		}
+
+		_, err = s.Write(buf)
+		if err != nil {
+			errCh <- err
+			return
+		}
+
+		timer.Reset(pingTimeout)
+	}
+}
+
+// Ping pings the remote peer until the context is canceled, returning a
+// stream of RTTs or errors.
+func (ps *PingService) Ping(ctx context.Context, p peer.ID) <-chan Result {
+	return Ping(ctx, ps.Host, p)
+}
+
+// Ping pings the remote peer using the given host until the context is
+// canceled, returning a stream of RTTs or errors. Every successful ping is
+// recorded in the peerstore latency metrics.
+func Ping(ctx context.Context, h host.Host, p peer.ID) <-chan Result {
+	s, err := h.NewStream(ctx, p, ID)
+	if err != nil {
+		ch := make(chan Result, 1)
+		ch <- Result{Error: err}
+		close(ch)
+		return ch
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	out := make(chan Result)
+	go func() {
+		defer close(out)
+		defer cancel()
+
+		for ctx.Err() == nil {
+			var res Result
+			res.RTT, res.Error = ping(s)
+
+			// canceled, ignore everything.
+			if ctx.Err() != nil {
+				return
+			}
+
+			// No error, record the RTT.
+			if res.Error == nil {
+				h.Peerstore().RecordLatency(p, res.RTT)
+			}
+
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		// forces the ping to abort.
+		<-ctx.Done()
+		s.Reset()
+	}()
+
+	return out
+}
+
+func ping(s network.Stream) (time.Duration, error) {
+	buf := pool.Get(PingSize)
+	defer pool.Put(buf)
+
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
+		return 0, err
+	}
+
+	before := time.Now()
+	if _, err := s.Write(buf); err != nil {
+		return 0, err
+	}
+
+	rbuf := pool.Get(PingSize)
+	defer pool.Put(rbuf)
+	if _, err := io.ReadFull(s, rbuf); err != nil {
+		return 0, err
+	}
+
+	if !bytes.Equal(buf, rbuf) {
+		return 0, ErrPingMismatch
+	}
+
+	return time.Since(before), nil
+}
+
+// probe periodically pings every connected peer once
+func (ps *PingService) probe() {
+	defer ps.wg.Done()
+	ticker := time.NewTicker(ps.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ps.probeOnce()
+		case <-ps.ctx.Done():
+			return
+		}
+	}
+}
+
+func (ps *PingService) probeOnce() {
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, ps.probeConcurrency)
+	for _, p := range ps.Host.Network().Peers() {
+		select {
+		case limit <- struct{}{}:
+		case <-ps.ctx.Done():
+			wg.Wait()
+			return
+		}
+		wg.Add(1)
+		go func(p peer.ID) {
+			defer func() {
+				<-limit
+				wg.Done()
+			}()
+			// never dial just to measure latency
+			ctx, cancel := context.WithTimeout(network.WithNoDial(ps.ctx, "ping probe"), ps.probeTimeout)
+			defer cancel()
+			res, ok := <-Ping(ctx, ps.Host, p)
+			if ok && res.Error != nil {
+				ps.logger.Debug("ping probe failed", zap.Error(res.Error), zap.String("peer.id", p.String()))
+			}
+		}(p)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,88 @@
+package ping
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	bhost "github.com/RTradeLtd/libp2px/pkg/blankhost"
+	swarmt "github.com/RTradeLtd/libp2px/pkg/swarm/testing"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1 := bhost.NewBlankHost(s1)
+	h2 := bhost.NewBlankHost(s2)
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	ps1, err := NewPingService(ctx, h1, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps1.Close()
+	ps2, err := NewPingService(ctx, h2, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps2.Close()
+
+	pctx, pcancel := context.WithCancel(ctx)
+	defer pcancel()
+	results := ps1.Ping(pctx, h2.ID())
+	for i := 0; i < 5; i++ {
+		select {
+		case res := <-results:
+			if res.Error != nil {
+				t.Fatal(res.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ping took too long")
+		}
+	}
+	if h1.Peerstore().LatencyEWMA(h2.ID()) == 0 {
+		t.Fatal("latency was not recorded")
+	}
+}
+
+func TestPingProber(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s1, closer1 := swarmt.GenSwarm(t, ctx)
+	defer closer1()
+	s2, closer2 := swarmt.GenSwarm(t, ctx)
+	defer closer2()
+	h1 := bhost.NewBlankHost(s1)
+	h2 := bhost.NewBlankHost(s2)
+
+	ps2, err := NewPingService(ctx, h2, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps2.Close()
+	ps1, err := NewPingService(ctx, h1, zaptest.NewLogger(t), WithProber(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps1.Close()
+
+	if err := h1.Connect(ctx, h2.Peerstore().PeerInfo(h2.ID())); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h1.Peerstore().LatencyEWMA(h2.ID()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("prober did not record latency")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -68,6 +68,26 @@ type GossipSubRouter struct {
 	tracer  *pubsubTracer
 }
 
+// state snapshots the mesh and fanout maps, from the event loop
+func (gs *GossipSubRouter) state() RouterState {
+	return RouterState{
+		Mesh:   peerLists(gs.mesh),
+		Fanout: peerLists(gs.fanout),
+	}
+}
+
+func peerLists(topics map[string]map[peer.ID]struct{}) map[string][]peer.ID {
+	lists := make(map[string][]peer.ID, len(topics))
+	for topic, peers := range topics {
+		list := make([]peer.ID, 0, len(peers))
+		for p := range peers {
+			list = append(list, p)
+		}
+		lists[topic] = list
+	}
+	return lists
+}
+
 func (gs *GossipSubRouter) Protocols() []protocol.ID {
 	return []protocol.ID{GossipSubID, FloodSubID}
 }
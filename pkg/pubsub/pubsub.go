@@ -944,6 +944,34 @@ func (p *PubSub) ListPeers(topic string) []peer.ID {
 	return <-out
 }
 
+// RouterState is a snapshot of the overlay maintained by the router. Routers
+// without an overlay, such as floodsub, leave it empty.
+type RouterState struct {
+	// Mesh lists the mesh peers of each joined topic
+	Mesh map[string][]peer.ID
+	// Fanout lists the fanout peers of each topic we publish to without
+	// having joined it
+	Fanout map[string][]peer.ID
+}
+
+// RouterState returns a snapshot of the overlay maintained by the router.
+func (p *PubSub) RouterState() RouterState {
+	out := make(chan RouterState, 1)
+	eval := func() {
+		var st RouterState
+		if r, ok := p.rt.(interface{ state() RouterState }); ok {
+			st = r.state()
+		}
+		out <- st
+	}
+	select {
+	case p.eval <- eval:
+	case <-p.ctx.Done():
+		return RouterState{}
+	}
+	return <-out
+}
+
 // BlacklistPeer blacklists a peer; all messages from this peer will be unconditionally dropped.
 func (p *PubSub) BlacklistPeer(pid peer.ID) {
 	select {
@@ -0,0 +1,106 @@
+package rcmgr
+
+import (
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+)
+
+// Limit is the amount of resources a single scope may hold.
+// A zero value means the resource is not limited in that scope.
+type Limit struct {
+	// Memory is the number of bytes that may be reserved
+	Memory int64
+
+	// Conns bounds the total number of connections, while ConnsInbound
+	// and ConnsOutbound bound them per direction
+	Conns         int
+	ConnsInbound  int
+	ConnsOutbound int
+
+	// Streams bounds the total number of streams, while StreamsInbound
+	// and StreamsOutbound bound them per direction
+	Streams         int
+	StreamsInbound  int
+	StreamsOutbound int
+}
+
+// LimitConfig holds the limits of every scope of a ResourceManager
+type LimitConfig struct {
+	// System limits the resources used by the whole node
+	System Limit
+	// Transient limits the resources held by streams that have not yet
+	// negotiated a protocol
+	Transient Limit
+
+	// PeerDefault limits the resources used by a single remote peer,
+	// unless overridden in Peer
+	PeerDefault Limit
+	Peer        map[peer.ID]Limit
+
+	// ProtocolDefault limits the resources used by all streams speaking a
+	// single protocol, unless overridden in Protocol
+	ProtocolDefault Limit
+	Protocol        map[protocol.ID]Limit
+
+	// ServiceDefault limits the resources used by all streams attached to a
+	// single service, unless overridden in Service
+	ServiceDefault Limit
+	Service        map[string]Limit
+}
+
+// DefaultLimits returns a LimitConfig suitable for most nodes
+func DefaultLimits() LimitConfig {
+	return LimitConfig{
+		System: Limit{
+			Memory:          1 << 30,
+			Conns:           1024,
+			ConnsInbound:    512,
+			ConnsOutbound:   1024,
+			Streams:         16384,
+			StreamsInbound:  8192,
+			StreamsOutbound: 16384,
+		},
+		Transient: Limit{
+			Memory:          64 << 20,
+			Streams:         512,
+			StreamsInbound:  256,
+			StreamsOutbound: 512,
+		},
+		PeerDefault: Limit{
+			Memory:          64 << 20,
+			Conns:           8,
+			ConnsInbound:    4,
+			ConnsOutbound:   8,
+			Streams:         1024,
+			StreamsInbound:  512,
+			StreamsOutbound: 1024,
+		},
+		ProtocolDefault: Limit{
+			Memory:          256 << 20,
+			Streams:         4096,
+			StreamsInbound:  2048,
+			StreamsOutbound: 4096,
+		},
+	}
+}
+
+func (cfg *LimitConfig) peerLimit(p peer.ID) Limit {
+	if l, ok := cfg.Peer[p]; ok {
+		return l
+	}
+	return cfg.PeerDefault
+}
+
+func (cfg *LimitConfig) protocolLimit(proto protocol.ID) Limit {
+	if l, ok := cfg.Protocol[proto]; ok {
+		return l
+	}
+	return cfg.ProtocolDefault
+}
+
+func (cfg *LimitConfig) serviceLimit(svc string) Limit {
+	if l, ok := cfg.Service[svc]; ok {
+		return l
+	}
+	return cfg.ServiceDefault
+}
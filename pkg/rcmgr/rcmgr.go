@@ -0,0 +1,370 @@
+// Package rcmgr provides a resource manager that limits the connections,
+// streams and memory held by a node. Resources are accounted in scopes: the
+// system scope spans the whole node, the transient scope holds streams that
+// have not yet negotiated a protocol, and peer, protocol and service scopes
+// bound what a single remote peer, protocol or service may hold.
+package rcmgr
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/protocol"
+)
+
+// ErrScopeClosed is returned when reserving resources in a scope that is done
+var ErrScopeClosed = errors.New("resource scope closed")
+
+// MemoryManager is used by stream multiplexers to account the memory they
+// buffer on behalf of a stream
+type MemoryManager interface {
+	// ReserveMemory reserves size bytes, failing with a *LimitError if
+	// that would exceed a limit
+	ReserveMemory(size int) error
+	// ReleaseMemory releases size previously reserved bytes
+	ReleaseMemory(size int)
+}
+
+// Scoped is implemented by streams tracked by a ResourceManager
+type Scoped interface {
+	// Scope returns the scope of the stream, or nil if it isn't tracked
+	Scope() *StreamScope
+}
+
+// SetStreamProtocol moves the stream into the scope of the given protocol if
+// it is tracked by a ResourceManager, and is a no-op otherwise.
+func SetStreamProtocol(s network.Stream, proto protocol.ID) error {
+	if sc, ok := s.(Scoped); ok && sc.Scope() != nil {
+		return sc.Scope().SetProtocol(proto)
+	}
+	return nil
+}
+
+// SetStreamService attaches the stream to the scope of the given service if
+// it is tracked by a ResourceManager, and is a no-op otherwise.
+func SetStreamService(s network.Stream, svc string) error {
+	if sc, ok := s.(Scoped); ok && sc.Scope() != nil {
+		return sc.Scope().SetService(svc)
+	}
+	return nil
+}
+
+type scopeKind int
+
+const (
+	peerScope scopeKind = iota
+	protocolScope
+	serviceScope
+)
+
+type scopeKey struct {
+	kind scopeKind
+	name string
+}
+
+// ResourceManager tracks the connections, streams and memory held by a node,
+// refusing any reservation that would exceed the limits of a scope.
+type ResourceManager struct {
+	limits LimitConfig
+
+	system    *resourceScope
+	transient *resourceScope
+
+	// peer, protocol and service scopes, created on demand and dropped once
+	// no conn or stream references them anymore
+	mu     sync.Mutex
+	scopes map[scopeKey]*resourceScope
+}
+
+// NewResourceManager returns a ResourceManager enforcing the given limits
+func NewResourceManager(limits LimitConfig) *ResourceManager {
+	return &ResourceManager{
+		limits:    limits,
+		system:    newResourceScope("system", limits.System),
+		transient: newResourceScope("transient", limits.Transient),
+		scopes:    make(map[scopeKey]*resourceScope),
+	}
+}
+
+// acquire returns the scope for the given key, taking a reference on it
+func (rm *ResourceManager) acquire(key scopeKey) *resourceScope {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rs, ok := rm.scopes[key]
+	if !ok {
+		switch key.kind {
+		case peerScope:
+			p := peer.ID(key.name)
+			rs = newResourceScope("peer:"+p.Pretty(), rm.limits.peerLimit(p))
+		case protocolScope:
+			rs = newResourceScope("protocol:"+key.name, rm.limits.protocolLimit(protocol.ID(key.name)))
+		case serviceScope:
+			rs = newResourceScope("service:"+key.name, rm.limits.serviceLimit(key.name))
+		}
+		rm.scopes[key] = rs
+	}
+	rs.refs++
+	return rs
+}
+
+// unref drops a reference taken by acquire
+func (rm *ResourceManager) unref(key scopeKey) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rs, ok := rm.scopes[key]
+	if !ok {
+		return
+	}
+	if rs.refs--; rs.refs <= 0 {
+		delete(rm.scopes, key)
+	}
+}
+
+// Stat is a snapshot of the resources held by a ResourceManager
+type Stat struct {
+	System    ScopeStat
+	Transient ScopeStat
+	Peers     map[peer.ID]ScopeStat
+	Protocols map[protocol.ID]ScopeStat
+	Services  map[string]ScopeStat
+}
+
+// Stat returns a snapshot of the resources currently held in every scope
+func (rm *ResourceManager) Stat() Stat {
+	st := Stat{
+		System:    rm.system.snapshot(),
+		Transient: rm.transient.snapshot(),
+		Peers:     make(map[peer.ID]ScopeStat),
+		Protocols: make(map[protocol.ID]ScopeStat),
+		Services:  make(map[string]ScopeStat),
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	for key, rs := range rm.scopes {
+		ss := rs.snapshot()
+		if ss.isZero() {
+			continue
+		}
+		switch key.kind {
+		case peerScope:
+			st.Peers[peer.ID(key.name)] = ss
+		case protocolScope:
+			st.Protocols[protocol.ID(key.name)] = ss
+		case serviceScope:
+			st.Services[key.name] = ss
+		}
+	}
+	return st
+}
+
+// ConnScope holds the resources reserved for a single connection
+type ConnScope struct {
+	rm   *ResourceManager
+	key  scopeKey
+	peer *resourceScope
+	res  resources
+	once sync.Once
+}
+
+// OpenConnection reserves a connection in the given direction to peer p,
+// failing with a *LimitError if the system or peer limits are exceeded.
+// Done must be called on the returned scope once the connection is closed.
+func (rm *ResourceManager) OpenConnection(dir network.Direction, p peer.ID) (*ConnScope, error) {
+	key := scopeKey{kind: peerScope, name: string(p)}
+	ps := rm.acquire(key)
+	r := connResources(dir)
+	if err := reserveAll([]*resourceScope{ps, rm.system}, r); err != nil {
+		rm.unref(key)
+		return nil, err
+	}
+	return &ConnScope{rm: rm, key: key, peer: ps, res: r}, nil
+}
+
+// Done releases the resources held by the connection
+func (c *ConnScope) Done() {
+	c.once.Do(func() {
+		releaseAll([]*resourceScope{c.peer, c.rm.system}, c.res)
+		c.rm.unref(c.key)
+	})
+}
+
+// StreamScope holds the resources reserved for a single stream. A stream
+// starts in the transient scope, and moves to the scope of its protocol once
+// negotiated. It can additionally be attached to the scope of a service.
+type StreamScope struct {
+	rm *ResourceManager
+
+	mu   sync.Mutex
+	res  resources
+	done bool
+
+	peer     *resourceScope
+	edge     *resourceScope // transient until a protocol is set
+	service  *resourceScope
+	owned    []scopeKey
+	protocol protocol.ID
+	svc      string
+}
+
+var _ MemoryManager = (*StreamScope)(nil)
+
+// OpenStream reserves a stream in the given direction to peer p, failing
+// with a *LimitError if the system, transient or peer limits are exceeded.
+// Done must be called on the returned scope once the stream is closed.
+func (rm *ResourceManager) OpenStream(p peer.ID, dir network.Direction) (*StreamScope, error) {
+	key := scopeKey{kind: peerScope, name: string(p)}
+	s := &StreamScope{
+		rm:    rm,
+		res:   streamResources(dir),
+		peer:  rm.acquire(key),
+		edge:  rm.transient,
+		owned: []scopeKey{key},
+	}
+	if err := reserveAll(s.scopes(), s.res); err != nil {
+		rm.unref(key)
+		return nil, err
+	}
+	return s, nil
+}
+
+// scopes returns every scope the stream is charged to. Must be called with
+// the lock held.
+func (s *StreamScope) scopes() []*resourceScope {
+	scopes := []*resourceScope{s.peer, s.edge}
+	if s.service != nil {
+		scopes = append(scopes, s.service)
+	}
+	return append(scopes, s.rm.system)
+}
+
+// move charges the resources of the stream to next instead of prev, taking
+// ownership of the scope for key
+func (s *StreamScope) move(prev *resourceScope, key scopeKey) (*resourceScope, error) {
+	next := s.rm.acquire(key)
+	if err := next.reserve(s.res); err != nil {
+		s.rm.unref(key)
+		return nil, err
+	}
+	if prev != nil {
+		prev.release(s.res)
+	}
+	s.owned = append(s.owned, key)
+	return next, nil
+}
+
+// disown drops the reference held on the scope for key
+func (s *StreamScope) disown(key scopeKey) {
+	for i, k := range s.owned {
+		if k == key {
+			s.owned = append(s.owned[:i], s.owned[i+1:]...)
+			s.rm.unref(key)
+			return
+		}
+	}
+}
+
+// Protocol returns the protocol of the stream, if set
+func (s *StreamScope) Protocol() protocol.ID {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protocol
+}
+
+// SetProtocol moves the stream from the transient scope, or the scope of its
+// previous protocol, into the scope of proto.
+func (s *StreamScope) SetProtocol(proto protocol.ID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrScopeClosed
+	}
+	if s.protocol == proto {
+		return nil
+	}
+	next, err := s.move(s.edge, scopeKey{kind: protocolScope, name: string(proto)})
+	if err != nil {
+		return err
+	}
+	if s.protocol != "" {
+		s.disown(scopeKey{kind: protocolScope, name: string(s.protocol)})
+	}
+	s.edge, s.protocol = next, proto
+	return nil
+}
+
+// Service returns the service of the stream, if set
+func (s *StreamScope) Service() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.svc
+}
+
+// SetService attaches the stream to the scope of svc, replacing any service
+// it was previously attached to.
+func (s *StreamScope) SetService(svc string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrScopeClosed
+	}
+	if s.svc == svc {
+		return nil
+	}
+	next, err := s.move(s.service, scopeKey{kind: serviceScope, name: svc})
+	if err != nil {
+		return err
+	}
+	if s.svc != "" {
+		s.disown(scopeKey{kind: serviceScope, name: s.svc})
+	}
+	s.service, s.svc = next, svc
+	return nil
+}
+
+// ReserveMemory reserves size bytes for the stream in every scope it is
+// charged to.
+func (s *StreamScope) ReserveMemory(size int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return ErrScopeClosed
+	}
+	r := resources{Memory: int64(size)}
+	if err := reserveAll(s.scopes(), r); err != nil {
+		return err
+	}
+	s.res.Memory += r.Memory
+	return nil
+}
+
+// ReleaseMemory releases size bytes previously reserved for the stream
+func (s *StreamScope) ReleaseMemory(size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	r := resources{Memory: int64(size)}
+	if r.Memory > s.res.Memory {
+		r.Memory = s.res.Memory
+	}
+	releaseAll(s.scopes(), r)
+	s.res.Memory -= r.Memory
+}
+
+// Done releases every resource held by the stream
+func (s *StreamScope) Done() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return
+	}
+	s.done = true
+	releaseAll(s.scopes(), s.res)
+	for _, key := range s.owned {
+		s.rm.unref(key)
+	}
+	s.owned = nil
+}
@@ -0,0 +1,103 @@
+package rcmgr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+	tu "github.com/RTradeLtd/libp2px-core/test"
+)
+
+func TestConnLimits(t *testing.T) {
+	rm := NewResourceManager(LimitConfig{
+		System:      Limit{Conns: 3},
+		PeerDefault: Limit{ConnsInbound: 1},
+	})
+	p1, _ := tu.RandPeerID()
+	p2, _ := tu.RandPeerID()
+
+	c1, err := rm.OpenConnection(network.DirInbound, p1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.OpenConnection(network.DirInbound, p1); !errors.Is(err, ErrResourceLimitExceeded) {
+		t.Fatalf("expected peer inbound limit to be hit, got %v", err)
+	}
+	if _, err := rm.OpenConnection(network.DirOutbound, p1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.OpenConnection(network.DirInbound, p2); err != nil {
+		t.Fatal(err)
+	}
+	_, err = rm.OpenConnection(network.DirOutbound, p2)
+	var lerr *LimitError
+	if !errors.As(err, &lerr) || lerr.Scope != "system" {
+		t.Fatalf("expected system limit to be hit, got %v", err)
+	}
+
+	c1.Done()
+	c1.Done()
+	if st := rm.Stat(); st.System.ConnsInbound != 1 || st.System.ConnsOutbound != 1 {
+		t.Fatalf("unexpected system stat %+v", st.System)
+	}
+	if _, err := rm.OpenConnection(network.DirInbound, p1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStreamScopes(t *testing.T) {
+	rm := NewResourceManager(LimitConfig{
+		Transient:       Limit{Streams: 1},
+		ProtocolDefault: Limit{StreamsInbound: 1, Memory: 100},
+		ServiceDefault:  Limit{Memory: 50},
+	})
+	p, _ := tu.RandPeerID()
+
+	s1, err := rm.OpenStream(p, network.DirInbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.OpenStream(p, network.DirInbound); !errors.Is(err, ErrResourceLimitExceeded) {
+		t.Fatalf("expected transient limit to be hit, got %v", err)
+	}
+	if err := s1.SetProtocol("/test"); err != nil {
+		t.Fatal(err)
+	}
+	if st := rm.Stat(); st.Transient.StreamsInbound != 0 || st.Protocols["/test"].StreamsInbound != 1 {
+		t.Fatalf("stream was not moved to the protocol scope: %+v", st)
+	}
+
+	s2, err := rm.OpenStream(p, network.DirInbound)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.SetProtocol("/test"); !errors.Is(err, ErrResourceLimitExceeded) {
+		t.Fatalf("expected protocol limit to be hit, got %v", err)
+	}
+	s2.Done()
+
+	if err := s1.ReserveMemory(80); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.SetService("svc"); !errors.Is(err, ErrResourceLimitExceeded) {
+		t.Fatalf("expected service memory limit to be hit, got %v", err)
+	}
+	s1.ReleaseMemory(40)
+	if err := s1.SetService("svc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s1.ReserveMemory(20); !errors.Is(err, ErrResourceLimitExceeded) {
+		t.Fatalf("expected service memory limit to be hit, got %v", err)
+	}
+
+	s1.Done()
+	st := rm.Stat()
+	if !st.System.isZero() || len(st.Peers)+len(st.Protocols)+len(st.Services) != 0 {
+		t.Fatalf("resources leaked: %+v", st)
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if len(rm.scopes) != 0 {
+		t.Fatalf("%d scopes were not collected", len(rm.scopes))
+	}
+}
@@ -0,0 +1,161 @@
+package rcmgr
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/RTradeLtd/libp2px-core/network"
+)
+
+// ErrResourceLimitExceeded is wrapped by every *LimitError, allowing limit
+// hits to be identified with errors.Is
+var ErrResourceLimitExceeded = errors.New("resource limit exceeded")
+
+// LimitError is returned when a reservation would exceed the limit of a scope
+type LimitError struct {
+	// Scope is the name of the scope whose limit was hit, such as "system",
+	// "peer:<id>" or "protocol:<id>"
+	Scope string
+	// Resource is the name of the limited resource, such as "memory" or "streams"
+	Resource string
+	// Current is the amount in use before the reservation, Limit the configured limit
+	Current int64
+	Limit   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s: %s in scope %s (%d of %d in use)", ErrResourceLimitExceeded, e.Resource, e.Scope, e.Current, e.Limit)
+}
+
+// Unwrap returns ErrResourceLimitExceeded
+func (e *LimitError) Unwrap() error {
+	return ErrResourceLimitExceeded
+}
+
+var _ error = (*LimitError)(nil)
+
+// ScopeStat is a snapshot of the resources held in a scope
+type ScopeStat struct {
+	Memory          int64
+	ConnsInbound    int
+	ConnsOutbound   int
+	StreamsInbound  int
+	StreamsOutbound int
+}
+
+func (st ScopeStat) isZero() bool {
+	return st == ScopeStat{}
+}
+
+// resources is a set of resources reserved or released together
+type resources ScopeStat
+
+func connResources(dir network.Direction) resources {
+	if dir == network.DirInbound {
+		return resources{ConnsInbound: 1}
+	}
+	return resources{ConnsOutbound: 1}
+}
+
+func streamResources(dir network.Direction) resources {
+	if dir == network.DirInbound {
+		return resources{StreamsInbound: 1}
+	}
+	return resources{StreamsOutbound: 1}
+}
+
+// resourceScope accounts the resources held against a single Limit
+type resourceScope struct {
+	sync.Mutex
+	name  string
+	limit Limit
+	stat  ScopeStat
+
+	// number of open conn and stream scopes referencing this scope, used to
+	// garbage collect peer, protocol and service scopes. Guarded by the
+	// ResourceManager lock.
+	refs int
+}
+
+func newResourceScope(name string, limit Limit) *resourceScope {
+	return &resourceScope{name: name, limit: limit}
+}
+
+func exceeds(limit int64, current, add int64) bool {
+	return limit > 0 && add > 0 && current+add > limit
+}
+
+func (rs *resourceScope) check(r resources) error {
+	st, l := rs.stat, rs.limit
+	var (
+		resource       string
+		current, limit int64
+	)
+	switch {
+	case exceeds(l.Memory, st.Memory, r.Memory):
+		resource, current, limit = "memory", st.Memory, l.Memory
+	case exceeds(int64(l.Conns), int64(st.ConnsInbound+st.ConnsOutbound), int64(r.ConnsInbound+r.ConnsOutbound)):
+		resource, current, limit = "conns", int64(st.ConnsInbound+st.ConnsOutbound), int64(l.Conns)
+	case exceeds(int64(l.ConnsInbound), int64(st.ConnsInbound), int64(r.ConnsInbound)):
+		resource, current, limit = "inbound conns", int64(st.ConnsInbound), int64(l.ConnsInbound)
+	case exceeds(int64(l.ConnsOutbound), int64(st.ConnsOutbound), int64(r.ConnsOutbound)):
+		resource, current, limit = "outbound conns", int64(st.ConnsOutbound), int64(l.ConnsOutbound)
+	case exceeds(int64(l.Streams), int64(st.StreamsInbound+st.StreamsOutbound), int64(r.StreamsInbound+r.StreamsOutbound)):
+		resource, current, limit = "streams", int64(st.StreamsInbound+st.StreamsOutbound), int64(l.Streams)
+	case exceeds(int64(l.StreamsInbound), int64(st.StreamsInbound), int64(r.StreamsInbound)):
+		resource, current, limit = "inbound streams", int64(st.StreamsInbound), int64(l.StreamsInbound)
+	case exceeds(int64(l.StreamsOutbound), int64(st.StreamsOutbound), int64(r.StreamsOutbound)):
+		resource, current, limit = "outbound streams", int64(st.StreamsOutbound), int64(l.StreamsOutbound)
+	default:
+		return nil
+	}
+	return &LimitError{Scope: rs.name, Resource: resource, Current: current, Limit: limit}
+}
+
+func (rs *resourceScope) reserve(r resources) error {
+	rs.Lock()
+	defer rs.Unlock()
+	if err := rs.check(r); err != nil {
+		return err
+	}
+	rs.stat.Memory += r.Memory
+	rs.stat.ConnsInbound += r.ConnsInbound
+	rs.stat.ConnsOutbound += r.ConnsOutbound
+	rs.stat.StreamsInbound += r.StreamsInbound
+	rs.stat.StreamsOutbound += r.StreamsOutbound
+	return nil
+}
+
+func (rs *resourceScope) release(r resources) {
+	rs.Lock()
+	defer rs.Unlock()
+	rs.stat.Memory -= r.Memory
+	rs.stat.ConnsInbound -= r.ConnsInbound
+	rs.stat.ConnsOutbound -= r.ConnsOutbound
+	rs.stat.StreamsInbound -= r.StreamsInbound
+	rs.stat.StreamsOutbound -= r.StreamsOutbound
+}
+
+func (rs *resourceScope) snapshot() ScopeStat {
+	rs.Lock()
+	defer rs.Unlock()
+	return rs.stat
+}
+
+// reserveAll reserves r in every scope, or in none of them if any limit is hit
+func reserveAll(scopes []*resourceScope, r resources) error {
+	for i, rs := range scopes {
+		if err := rs.reserve(r); err != nil {
+			releaseAll(scopes[:i], r)
+			return err
+		}
+	}
+	return nil
+}
+
+func releaseAll(scopes []*resourceScope, r resources) {
+	for _, rs := range scopes {
+		rs.release(r)
+	}
+}
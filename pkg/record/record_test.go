@@ -0,0 +1,101 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/RTradeLtd/libp2px-core/crypto"
+	"github.com/RTradeLtd/libp2px-core/peer"
+	"github.com/RTradeLtd/libp2px-core/test"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+func newPeerRecord(t *testing.T) (*PeerRecord, crypto.PrivKey) {
+	sk, _, err := test.RandTestKeyPair(crypto.Ed25519, 256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := peer.IDFromPrivateKey(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := []ma.Multiaddr{
+		ma.StringCast("/ip4/1.2.3.4/tcp/4001"),
+		ma.StringCast("/ip6/::1/udp/4001/quic"),
+	}
+	return PeerRecordFromAddrInfo(peer.AddrInfo{ID: id, Addrs: addrs}), sk
+}
+
+func TestPeerRecordRoundtrip(t *testing.T) {
+	rec, sk := newPeerRecord(t)
+	data, err := rec.MarshalSigned(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env, untyped, err := ConsumeEnvelope(data, PeerRecordEnvelopeDomain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := untyped.(*PeerRecord)
+	if !ok || !got.Equal(rec) {
+		t.Fatalf("expected %+v, got %+v", rec, untyped)
+	}
+	if !env.PublicKey.Equals(sk.GetPublic()) || !bytes.Equal(env.PayloadType, PeerRecordEnvelopePayloadType) {
+		t.Fatal("unexpected envelope contents")
+	}
+
+	env2, got2, err := ConsumePeerRecord(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !env2.Equal(env) || !got2.Equal(rec) {
+		t.Fatal("typed consumption did not match")
+	}
+
+	if NewPeerRecord().Seq <= rec.Seq {
+		t.Fatal("sequence numbers must be increasing")
+	}
+}
+
+func TestEnvelopeValidation(t *testing.T) {
+	rec, sk := newPeerRecord(t)
+	env, err := rec.Sign(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := env.Validate("other-domain"); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected signature to be invalid in another domain, got %v", err)
+	}
+
+	env.RawPayload = append([]byte(nil), env.RawPayload...)
+	env.RawPayload[len(env.RawPayload)-1] ^= 0xff
+	data, err := env.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ConsumeEnvelope(data, PeerRecordEnvelopeDomain); err == nil {
+		t.Fatal("expected tampered envelope to be rejected")
+	}
+
+	// a record signed by another peer
+	other, osk := newPeerRecord(t)
+	if _, err := rec.Sign(osk); err == nil {
+		t.Fatal("expected signing with the key of another peer to fail")
+	}
+	other.PeerID = rec.PeerID
+	forged, err := Seal(other, osk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = forged.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ConsumePeerRecord(data); err != ErrSignerMismatch {
+		t.Fatalf("expected %v, got %v", ErrSignerMismatch, err)
+	}
+}
@@ -208,3 +208,26 @@ func (dl *dialLimiter) executeDial(j *dialJob) {
 		}
 	}
 }
+
+// DialLimiterStats is a snapshot of the dials queued in the dial limiter
+type DialLimiterStats struct {
+	// FDInUse is the number of dials holding a file descriptor token
+	FDInUse int
+	// FDWaiting is the number of dials waiting for a file descriptor token
+	FDWaiting int
+	// PeerWaiting is the number of dials waiting on their peer's limit
+	PeerWaiting int
+}
+
+func (dl *dialLimiter) stats() DialLimiterStats {
+	dl.lk.Lock()
+	defer dl.lk.Unlock()
+	st := DialLimiterStats{
+		FDInUse:   dl.fdConsuming,
+		FDWaiting: len(dl.waitingOnFd),
+	}
+	for _, waiting := range dl.waitingOnPeerLimit {
+		st.PeerWaiting += len(waiting)
+	}
+	return st
+}
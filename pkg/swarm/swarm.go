@@ -16,6 +16,9 @@ import (
 	"github.com/RTradeLtd/libp2px-core/transport"
 	"go.uber.org/zap"
 
+	connmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
+	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 	filter "github.com/RTradeLtd/libp2px/pkg/utils/filter"
 	ma "github.com/multiformats/go-multiaddr"
 	mafilter "github.com/whyrusleeping/multiaddr-filter"
@@ -85,6 +88,16 @@ type Swarm struct {
 
 	// filters for addresses that shouldnt be dialed (or accepted)
 	Filters *filter.Filters
+	// Gater is consulted before dialing peers and addresses, and before
+	// adding upgraded connections (optional)
+	Gater connmgr.ConnectionGater
+	// ResourceManager limits the connections and streams we hold (optional)
+	ResourceManager *rcmgr.ResourceManager
+	// Metrics is told of the outcome of every dial (optional)
+	Metrics MetricsTracer
+
+	eventsLk sync.Mutex
+	events   *swarmEvents
 
 	ctx      context.Context
 	cancel   context.CancelFunc
@@ -143,12 +156,14 @@ func (s *Swarm) teardown() error {
 				}
 			}(l)
 		}
-		for _, cs := range conns {
+		peers := make([]peer.ID, 0, len(conns))
+		for p, cs := range conns {
+			peers = append(peers, p)
 			for _, c := range cs {
 				s.refs.Add(1)
 				go func(cc *Conn) {
 					defer s.refs.Done()
-					if err := cc.Close(); err != nil {
+					if err := cc.closeWithReason(eventbus.CloseSwarm, nil); err != nil {
 						s.logger.Error("error shutting down connection", zap.Error(err))
 					}
 				}(c)
@@ -156,6 +171,7 @@ func (s *Swarm) teardown() error {
 		}
 		// Wait for everything to finish.
 		s.refs.Wait()
+		s.closeEvents(peers)
 		// close the peerstore and return
 		if err := s.peers.Close(); err != nil {
 			s.logger.Error("error shutting down peerstore")
@@ -185,9 +201,24 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 		tc.Close()
 		return nil, ErrAddrFiltered
 	}
+	if s.Gater != nil {
+		if err := connmgr.NewGateError(connmgr.GateUpgraded, s.Gater.InterceptUpgraded(tc)); err != nil {
+			tc.Close()
+			return nil, err
+		}
+	}
 
 	p := tc.RemotePeer()
 
+	var scope *rcmgr.ConnScope
+	if s.ResourceManager != nil {
+		var err error
+		if scope, err = s.ResourceManager.OpenConnection(dir, p); err != nil {
+			tc.Close()
+			return nil, err
+		}
+	}
+
 	// Add the public key.
 	if pk := tc.RemotePublicKey(); pk != nil {
 		s.peers.AddPubKey(p, pk)
@@ -202,18 +233,27 @@ func (s *Swarm) addConn(tc transport.CapableConn, dir network.Direction) (*Conn,
 	if s.conns.m == nil {
 		s.conns.Unlock()
 		tc.Close()
+		if scope != nil {
+			scope.Done()
+		}
 		return nil, ErrSwarmClosed
 	}
 
 	// Wrap and register the connection.
 	stat := network.Stat{Direction: dir}
 	c := &Conn{
-		conn:  tc,
-		swarm: s,
-		stat:  stat,
+		conn:   tc,
+		swarm:  s,
+		stat:   stat,
+		scope:  scope,
+		opened: time.Now(),
 	}
 	c.streams.m = make(map[*Stream]struct{})
 	s.conns.m[p] = append(s.conns.m[p], c)
+	s.emit(eventbus.EvtConnOpened{Conn: c, Transport: TransportName(raddr), Direction: dir})
+	if len(s.conns.m[p]) == 1 {
+		s.emit(eventbus.EvtPeerConnectednessChanged{Peer: p, Connectedness: network.Connected})
+	}
 
 	// Add two swarm refs:
 	// * One will be decremented after the close notifications fire in Conn.doClose
@@ -487,11 +527,13 @@ func (s *Swarm) removeConn(c *Conn) {
 
 	s.conns.Lock()
 	defer s.conns.Unlock()
+	s.emit(eventbus.EvtConnClosed{Conn: c, Reason: c.closeReason, Err: c.closeErr})
 	cs := s.conns.m[p]
 	for i, ci := range cs {
 		if ci == c {
 			if len(cs) == 1 {
 				delete(s.conns.m, p)
+				s.emit(eventbus.EvtPeerConnectednessChanged{Peer: p, Connectedness: network.NotConnected})
 			} else {
 				// NOTE: We're intentionally preserving order.
 				// This way, connections to a peer are always
@@ -4,13 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	ic "github.com/RTradeLtd/libp2px-core/crypto"
 	"github.com/RTradeLtd/libp2px-core/mux"
 	"github.com/RTradeLtd/libp2px-core/network"
 	"github.com/RTradeLtd/libp2px-core/peer"
 	"github.com/RTradeLtd/libp2px-core/transport"
+	"go.uber.org/zap"
 
+	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 	ma "github.com/multiformats/go-multiaddr"
 )
 
@@ -24,9 +28,14 @@ var ErrConnClosed = errors.New("connection closed")
 type Conn struct {
 	conn  transport.CapableConn
 	swarm *Swarm
+	// scope is nil unless the swarm has a resource manager
+	scope *rcmgr.ConnScope
 
 	closeOnce sync.Once
 	err       error
+	// why the connection was closed, and the error it failed with
+	closeReason eventbus.CloseReason
+	closeErr    error
 
 	notifyLk sync.Mutex
 
@@ -35,7 +44,8 @@ type Conn struct {
 		m map[*Stream]struct{}
 	}
 
-	stat network.Stat
+	stat   network.Stat
+	opened time.Time
 }
 
 // Close closes this connection.
@@ -45,7 +55,17 @@ type Conn struct {
 // open notifications must finish before we can fire off the close
 // notifications).
 func (c *Conn) Close() error {
-	c.closeOnce.Do(c.doClose)
+	return c.closeWithReason(eventbus.CloseLocal, nil)
+}
+
+// closeWithReason closes the connection, recording why for the EvtConnClosed
+// event. Only the first call decides the reason.
+func (c *Conn) closeWithReason(reason eventbus.CloseReason, err error) error {
+	c.closeOnce.Do(func() {
+		c.closeReason = reason
+		c.closeErr = err
+		c.doClose()
+	})
 	return c.err
 }
 
@@ -59,6 +79,9 @@ func (c *Conn) doClose() {
 	c.streams.Unlock()
 
 	c.err = c.conn.Close()
+	if c.scope != nil {
+		c.scope.Done()
+	}
 
 	// This is just for cleaning up state. The connection has already been closed.
 	// We *could* optimize this but it really isn't worth it.
@@ -92,11 +115,12 @@ func (c *Conn) removeStream(s *Stream) {
 func (c *Conn) start() {
 	go func() {
 		defer c.swarm.refs.Done()
-		defer c.Close()
 
 		for {
 			ts, err := c.conn.AcceptStream()
 			if err != nil {
+				// a no-op if we closed the connection ourselves
+				c.closeWithReason(eventbus.CloseRemote, err)
 				return
 			}
 			c.swarm.refs.Add(1)
@@ -107,8 +131,12 @@ func (c *Conn) start() {
 				// swarm shutdown on the connection handler.
 				c.swarm.refs.Done()
 
-				// We only get an error here when the swarm is closed or closing.
+				// We only get an error here when the swarm is closed or
+				// closing, or when the stream exceeds a resource limit.
 				if err != nil {
+					if errors.Is(err, rcmgr.ErrResourceLimitExceeded) {
+						c.swarm.logger.Debug("refused inbound stream", zap.Error(err), zap.String("peer.id", c.RemotePeer().String()))
+					}
 					return
 				}
 
@@ -166,6 +194,29 @@ func (c *Conn) Stat() network.Stat {
 	return c.stat
 }
 
+// Opened returns the time at which the connection was added to the swarm
+func (c *Conn) Opened() time.Time {
+	return c.opened
+}
+
+// Security returns the negotiated security protocol, or an empty string if
+// the transport does not report it
+func (c *Conn) Security() string {
+	if sc, ok := c.conn.(interface{ SecurityProtocol() string }); ok {
+		return sc.SecurityProtocol()
+	}
+	return ""
+}
+
+// Muxer returns the negotiated stream multiplexer, or an empty string if
+// the transport does not report it
+func (c *Conn) Muxer() string {
+	if mc, ok := c.conn.(interface{ MuxerProtocol() string }); ok {
+		return mc.MuxerProtocol()
+	}
+	return ""
+}
+
 // NewStream returns a new Stream from this connection
 func (c *Conn) NewStream() (network.Stream, error) {
 	ts, err := c.conn.OpenStream()
@@ -175,6 +226,12 @@ func (c *Conn) NewStream() (network.Stream, error) {
 	return c.addStream(ts, network.DirOutbound)
 }
 
+// memoryScoped is implemented by muxed streams that account the memory they
+// buffer in a resource manager
+type memoryScoped interface {
+	SetMemoryManager(mm rcmgr.MemoryManager) error
+}
+
 func (c *Conn) addStream(ts mux.MuxedStream, dir network.Direction) (*Stream, error) {
 	c.streams.Lock()
 	// Are we still online?
@@ -184,12 +241,34 @@ func (c *Conn) addStream(ts mux.MuxedStream, dir network.Direction) (*Stream, er
 		return nil, ErrConnClosed
 	}
 
+	// Reserve the stream, resetting it if that exceeds a limit.
+	var scope *rcmgr.StreamScope
+	if rm := c.swarm.ResourceManager; rm != nil {
+		var err error
+		if scope, err = rm.OpenStream(c.RemotePeer(), dir); err != nil {
+			c.streams.Unlock()
+			ts.Reset()
+			return nil, err
+		}
+		// let the muxer account the memory it buffers for the stream
+		if ms, ok := ts.(memoryScoped); ok {
+			if err := ms.SetMemoryManager(scope); err != nil {
+				c.streams.Unlock()
+				ts.Reset()
+				scope.Done()
+				return nil, err
+			}
+		}
+	}
+
 	// Wrap and register the stream.
 	stat := network.Stat{Direction: dir}
 	s := &Stream{
 		stream: ts,
 		conn:   c,
 		stat:   stat,
+		scope:  scope,
+		opened: time.Now(),
 	}
 	c.streams.m[s] = struct{}{}
 
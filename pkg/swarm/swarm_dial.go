@@ -12,6 +12,7 @@ import (
 	"github.com/RTradeLtd/libp2px-core/transport"
 	"go.uber.org/zap"
 
+	connmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
 	addrutil "github.com/RTradeLtd/libp2px/pkg/utils/addr"
 	ma "github.com/multiformats/go-multiaddr"
 )
@@ -197,6 +198,11 @@ func (s *Swarm) dialPeer(ctx context.Context, p peer.ID) (*Conn, error) {
 	if p == s.local {
 		return nil, ErrDialToSelf
 	}
+	if s.Gater != nil {
+		if err := connmgr.NewGateError(connmgr.GatePeerDial, s.Gater.InterceptPeerDial(p)); err != nil {
+			return nil, &DialError{Peer: p, Cause: err}
+		}
+	}
 	// check if we already have an open connection first
 	conn := s.bestConnToPeer(p)
 	if conn != nil {
@@ -292,6 +298,12 @@ func (s *Swarm) dial(ctx context.Context, p peer.ID) (*Conn, error) {
 	if len(goodAddrs) == 0 {
 		return nil, &DialError{Peer: p, Cause: ErrNoGoodAddresses}
 	}
+	if s.Gater != nil {
+		var gateErr *DialError
+		if goodAddrs, gateErr = s.gateAddrs(p, goodAddrs); gateErr != nil {
+			return nil, gateErr
+		}
+	}
 	goodAddrsChan := make(chan ma.Multiaddr, len(goodAddrs))
 	for _, a := range goodAddrs {
 		goodAddrsChan <- a
@@ -347,13 +359,31 @@ func (s *Swarm) filterKnownUndialables(addrs []ma.Multiaddr) []ma.Multiaddr {
 	)
 }
 
+// gateAddrs removes the addresses our gater refuses to dial, returning a
+// *DialError recording every refusal if none remain.
+func (s *Swarm) gateAddrs(p peer.ID, addrs []ma.Multiaddr) ([]ma.Multiaddr, *DialError) {
+	allowed := make([]ma.Multiaddr, 0, len(addrs))
+	gated := &DialError{Peer: p, Cause: ErrNoGoodAddresses}
+	for _, a := range addrs {
+		if err := connmgr.NewGateError(connmgr.GateAddrDial, s.Gater.InterceptAddrDial(p, a)); err != nil {
+			gated.recordErr(a, err)
+			continue
+		}
+		allowed = append(allowed, a)
+	}
+	if len(allowed) == 0 {
+		return nil, gated
+	}
+	return allowed, nil
+}
+
 func (s *Swarm) dialAddrs(ctx context.Context, p peer.ID, remoteAddrs <-chan ma.Multiaddr) (transport.CapableConn, *DialError) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel() // cancel work when we exit func
 
 	// use a single response type instead of errs and conns, reduces complexity *a ton*
 	respch := make(chan dialResult)
-	err := new(DialError)
+	err := &DialError{Peer: p}
 
 	defer s.limiter.clearAllPeerDials(p)
 
@@ -423,7 +453,13 @@ func (s *Swarm) limitedDial(ctx context.Context, p peer.ID, a ma.Multiaddr, resp
 	})
 }
 
-func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (transport.CapableConn, error) {
+func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (connC transport.CapableConn, err error) {
+	if s.Metrics != nil {
+		start := time.Now()
+		defer func() {
+			s.Metrics.DialCompleted(addr, err, time.Since(start))
+		}()
+	}
 	// Just to double check. Costs nothing.
 	if s.local == p {
 		return nil, ErrDialToSelf
@@ -433,7 +469,7 @@ func (s *Swarm) dialAddr(ctx context.Context, p peer.ID, addr ma.Multiaddr) (tra
 		return nil, ErrNoTransport
 	}
 
-	connC, err := tpt.Dial(ctx, addr, p)
+	connC, err = tpt.Dial(ctx, addr, p)
 	if err != nil {
 		return nil, err
 	}
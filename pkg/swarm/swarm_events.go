@@ -0,0 +1,149 @@
+package swarm
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/RTradeLtd/libp2px-core/event"
+	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/peer"
+
+	eventbus "github.com/RTradeLtd/libp2px/pkg/eventbus"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// swarmEvents emits the connection events of the swarm on an event bus.
+// Events are queued in the order they happen and emitted by a single
+// goroutine, so a slow subscriber delays its own events but never blocks the
+// swarm the way a slow Notifiee does.
+type swarmEvents struct {
+	mu     sync.Mutex
+	queue  []interface{}
+	closed bool
+	wake   chan struct{}
+
+	connectedness event.Emitter
+	opened        event.Emitter
+	closedConn    event.Emitter
+}
+
+// SetEventBus makes the swarm emit EvtPeerConnectednessChanged,
+// EvtConnOpened and EvtConnClosed on bus. Hosts call it with their own bus
+// when they wrap the swarm, and it can only be called once.
+func (s *Swarm) SetEventBus(bus event.Bus) error {
+	s.eventsLk.Lock()
+	defer s.eventsLk.Unlock()
+	if s.events != nil {
+		return errors.New("swarm already has an event bus")
+	}
+	if s.ctx.Err() != nil {
+		return ErrSwarmClosed
+	}
+	ev := &swarmEvents{wake: make(chan struct{}, 1)}
+	var err error
+	if ev.connectedness, err = bus.Emitter(&eventbus.EvtPeerConnectednessChanged{}); err != nil {
+		return err
+	}
+	if ev.opened, err = bus.Emitter(&eventbus.EvtConnOpened{}); err != nil {
+		ev.connectedness.Close()
+		return err
+	}
+	if ev.closedConn, err = bus.Emitter(&eventbus.EvtConnClosed{}); err != nil {
+		ev.connectedness.Close()
+		ev.opened.Close()
+		return err
+	}
+	s.events = ev
+	go ev.run()
+	return nil
+}
+
+// emit queues an event, it must be called with the conns lock held so the
+// events of a peer are queued in order
+func (s *Swarm) emit(evt interface{}) {
+	s.eventsLk.Lock()
+	ev := s.events
+	s.eventsLk.Unlock()
+	if ev == nil {
+		return
+	}
+	ev.mu.Lock()
+	if !ev.closed {
+		ev.queue = append(ev.queue, evt)
+	}
+	ev.mu.Unlock()
+	select {
+	case ev.wake <- struct{}{}:
+	default:
+	}
+}
+
+// closeEvents emits the remaining events and releases the emitters. It's
+// called once the swarm is torn down, with the peers it was connected to.
+func (s *Swarm) closeEvents(peers []peer.ID) {
+	s.eventsLk.Lock()
+	ev := s.events
+	s.eventsLk.Unlock()
+	if ev == nil {
+		return
+	}
+	// the teardown emptied the conns map, so removeConn couldn't tell
+	// which connections were the last ones
+	for _, p := range peers {
+		s.emit(eventbus.EvtPeerConnectednessChanged{Peer: p, Connectedness: network.NotConnected})
+	}
+	ev.mu.Lock()
+	ev.closed = true
+	ev.mu.Unlock()
+	select {
+	case ev.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (ev *swarmEvents) run() {
+	for range ev.wake {
+		ev.mu.Lock()
+		queue, closed := ev.queue, ev.closed
+		ev.queue = nil
+		ev.mu.Unlock()
+
+		for _, evt := range queue {
+			switch evt.(type) {
+			case eventbus.EvtPeerConnectednessChanged:
+				ev.connectedness.Emit(evt)
+			case eventbus.EvtConnOpened:
+				ev.opened.Emit(evt)
+			case eventbus.EvtConnClosed:
+				ev.closedConn.Emit(evt)
+			}
+		}
+		if closed {
+			ev.connectedness.Close()
+			ev.opened.Close()
+			ev.closedConn.Close()
+			return
+		}
+	}
+}
+
+// TransportName names the transport of a connection from its remote address,
+// by joining the protocols above the network layer, like "tcp", "udp/quic"
+// or "tcp/ws". Relayed connections are named "p2p-circuit".
+func TransportName(addr ma.Multiaddr) string {
+	var names []string
+	for _, p := range addr.Protocols() {
+		switch p.Code {
+		case ma.P_CIRCUIT:
+			return p.Name
+		case ma.P_IP4, ma.P_IP6, ma.P_IP6ZONE, ma.P_DNS, ma.P_DNS4, ma.P_DNS6, ma.P_DNSADDR, ma.P_P2P:
+			continue
+		}
+		names = append(names, p.Name)
+	}
+	if len(names) == 0 {
+		return "unknown"
+	}
+	return strings.Join(names, "/")
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/RTradeLtd/libp2px-core/network"
+	"github.com/RTradeLtd/libp2px-core/transport"
 	"go.uber.org/zap"
 
 	ma "github.com/multiformats/go-multiaddr"
@@ -79,7 +80,10 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 		for {
 			c, err := list.Accept()
 			if err != nil {
-				if s.ctx.Err() == nil {
+				s.listeners.RLock()
+				_, open := s.listeners.m[list]
+				s.listeners.RUnlock()
+				if s.ctx.Err() == nil && open {
 					// only log if the swarm is still running.
 					s.logger.Error("listener accept error", zap.Error(err))
 				}
@@ -103,3 +107,29 @@ func (s *Swarm) AddListenAddr(a ma.Multiaddr) error {
 	}()
 	return nil
 }
+
+// CloseListeners stops listening on every address, leaving the existing
+// connections untouched. Unlike Close, the swarm remains usable.
+func (s *Swarm) CloseListeners() error {
+	s.listeners.Lock()
+	listeners := make([]transport.Listener, 0, len(s.listeners.m))
+	for l := range s.listeners.m {
+		listeners = append(listeners, l)
+		delete(s.listeners.m, l)
+	}
+	s.listeners.cacheEOL = time.Time{}
+	s.listeners.Unlock()
+
+	var err error
+	for _, l := range listeners {
+		maddr := l.Multiaddr()
+		if cerr := l.Close(); cerr != nil {
+			s.logger.Error("failed to close listener", zap.String("listen.addr", maddr.String()), zap.Error(cerr))
+			err = cerr
+		}
+		s.notifyAll(func(n network.Notifiee) {
+			n.ListenClose(s, maddr)
+		})
+	}
+	return err
+}
@@ -0,0 +1,21 @@
+package swarm
+
+import (
+	"time"
+
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// MetricsTracer is notified of swarm events worth exporting as metrics.
+// Connections and streams are not traced, as Conns and GetStreams already
+// report them.
+type MetricsTracer interface {
+	// DialCompleted is called once every dial to a single address returns,
+	// with a nil err if it succeeded.
+	DialCompleted(addr ma.Multiaddr, err error, took time.Duration)
+}
+
+// DialLimiterStats returns a snapshot of the dials queued by the swarm
+func (s *Swarm) DialLimiterStats() DialLimiterStats {
+	return s.limiter.stats()
+}
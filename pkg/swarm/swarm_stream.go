@@ -10,6 +10,8 @@ import (
 	"github.com/RTradeLtd/libp2px-core/mux"
 	"github.com/RTradeLtd/libp2px-core/network"
 	"github.com/RTradeLtd/libp2px-core/protocol"
+
+	rcmgr "github.com/RTradeLtd/libp2px/pkg/rcmgr"
 )
 
 type streamState int
@@ -24,12 +26,19 @@ const (
 
 // Validate Stream conforms to the go-libp2p-net Stream interface
 var _ network.Stream = &Stream{}
+var _ rcmgr.Scoped = &Stream{}
 
 // Stream is the stream type used by swarm. In general, you won't use this type
 // directly.
 type Stream struct {
+	// atomic counters, first for 64 bit alignment
+	bytesRead    uint64
+	bytesWritten uint64
+
 	stream mux.MuxedStream
 	conn   *Conn
+	// scope is nil unless the swarm has a resource manager
+	scope *rcmgr.StreamScope
 
 	state struct {
 		sync.Mutex
@@ -40,7 +49,8 @@ type Stream struct {
 
 	protocol atomic.Value
 
-	stat network.Stat
+	stat   network.Stat
+	opened time.Time
 }
 
 func (s *Stream) String() string {
@@ -62,6 +72,7 @@ func (s *Stream) Conn() network.Conn {
 // Read reads bytes from a stream.
 func (s *Stream) Read(p []byte) (int, error) {
 	n, err := s.stream.Read(p)
+	atomic.AddUint64(&s.bytesRead, uint64(n))
 	// TODO: push this down to a lower level for better accuracy.
 	if s.conn.swarm.bwc != nil {
 		s.conn.swarm.bwc.LogRecvMessage(int64(n))
@@ -86,6 +97,7 @@ func (s *Stream) Read(p []byte) (int, error) {
 // Write writes bytes to a stream, flushing for each call.
 func (s *Stream) Write(p []byte) (int, error) {
 	n, err := s.stream.Write(p)
+	atomic.AddUint64(&s.bytesWritten, uint64(n))
 	// TODO: push this down to a lower level for better accuracy.
 	if s.conn.swarm.bwc != nil {
 		s.conn.swarm.bwc.LogSentMessage(int64(n))
@@ -126,6 +138,9 @@ func (s *Stream) Reset() error {
 
 func (s *Stream) remove() {
 	s.conn.removeStream(s)
+	if s.scope != nil {
+		s.scope.Done()
+	}
 
 	// We *must* do this in a goroutine. This can be called during a
 	// an open notification and will block until that notification is done.
@@ -156,6 +171,12 @@ func (s *Stream) SetProtocol(p protocol.ID) {
 	s.protocol.Store(p)
 }
 
+// Scope returns the resource scope of this stream, or nil if the swarm has
+// no resource manager.
+func (s *Stream) Scope() *rcmgr.StreamScope {
+	return s.scope
+}
+
 // SetDeadline sets the read and write deadlines for this stream.
 func (s *Stream) SetDeadline(t time.Time) error {
 	return s.stream.SetDeadline(t)
@@ -175,3 +196,18 @@ func (s *Stream) SetWriteDeadline(t time.Time) error {
 func (s *Stream) Stat() network.Stat {
 	return s.stat
 }
+
+// Opened returns the time at which the stream was opened
+func (s *Stream) Opened() time.Time {
+	return s.opened
+}
+
+// BytesRead returns the number of bytes read from the stream
+func (s *Stream) BytesRead() uint64 {
+	return atomic.LoadUint64(&s.bytesRead)
+}
+
+// BytesWritten returns the number of bytes written to the stream
+func (s *Stream) BytesWritten() uint64 {
+	return atomic.LoadUint64(&s.bytesWritten)
+}
@@ -56,6 +56,7 @@ func GenUpgrader(n *swarm.Swarm) *tptu.Upgrader {
 		Secure:  secMuxer,
 		Muxer:   stMuxer,
 		Filters: n.Filters,
+		Gater:   n.Gater,
 	}
 
 }
@@ -59,6 +59,21 @@ type Relay struct {
 	// atomic counters
 	streamCount  int32
 	liveHopCount int32
+
+	statsMx      sync.Mutex
+	hopsAccepted uint64
+	hopsRefused  map[string]uint64
+}
+
+// HopStats counts the hop requests handled by a relay
+type HopStats struct {
+	// Active is the number of hops currently being relayed
+	Active int32
+	// Accepted is the number of hops relayed since the relay started
+	Accepted uint64
+	// Refused is the number of hops refused, by status name. Hops refused
+	// because the relay is at its stream limit are counted as STREAM_LIMIT.
+	Refused map[string]uint64
 }
 
 // Opt are options for configuring the relay transport.
@@ -98,6 +113,8 @@ func NewRelay(ctx context.Context, h host.Host, upgrader *tptu.Upgrader, opts ..
 		self:     h.ID(),
 		incoming: make(chan *Conn),
 		relays:   make(map[peer.ID]struct{}),
+
+		hopsRefused: make(map[string]uint64),
 	}
 
 	for _, opt := range opts {
@@ -127,6 +144,9 @@ func NewRelay(ctx context.Context, h host.Host, upgrader *tptu.Upgrader, opts ..
 // from pruning, thus minimizing disruption from connection trimming in a relay node.
 func (r *Relay) addLiveHop(from, to peer.ID) {
 	atomic.AddInt32(&r.liveHopCount, 1)
+	r.statsMx.Lock()
+	r.hopsAccepted++
+	r.statsMx.Unlock()
 	r.host.ConnManager().UpsertTag(from, "relay-hop-stream", incrementTag)
 	r.host.ConnManager().UpsertTag(to, "relay-hop-stream", incrementTag)
 }
@@ -145,6 +165,33 @@ func (r *Relay) GetActiveHops() int32 {
 	return atomic.LoadInt32(&r.liveHopCount)
 }
 
+// HopStats returns the hop counters of the relay
+func (r *Relay) HopStats() HopStats {
+	r.statsMx.Lock()
+	defer r.statsMx.Unlock()
+	st := HopStats{
+		Active:   r.GetActiveHops(),
+		Accepted: r.hopsAccepted,
+		Refused:  make(map[string]uint64, len(r.hopsRefused)),
+	}
+	for reason, n := range r.hopsRefused {
+		st.Refused[reason] = n
+	}
+	return st
+}
+
+func (r *Relay) recordRefusedHop(reason string) {
+	r.statsMx.Lock()
+	r.hopsRefused[reason]++
+	r.statsMx.Unlock()
+}
+
+// refuseHop records and answers the refusal of a hop request
+func (r *Relay) refuseHop(s network.Stream, code pb.CircuitRelay_Status) {
+	r.recordRefusedHop(code.String())
+	r.handleError(s, code)
+}
+
 // DialPeer attempts to dial the given peer
 func (r *Relay) DialPeer(ctx context.Context, relay peer.AddrInfo, dest peer.AddrInfo) (*Conn, error) {
 	if len(relay.Addrs) > 0 {
@@ -268,7 +315,7 @@ func (r *Relay) handleNewStream(s network.Stream) {
 
 func (r *Relay) handleHopStream(s network.Stream, msg *pb.CircuitRelay) {
 	if !r.hop {
-		r.handleError(s, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
+		r.refuseHop(s, pb.CircuitRelay_HOP_CANT_SPEAK_RELAY)
 		return
 	}
 
@@ -277,29 +324,30 @@ func (r *Relay) handleHopStream(s network.Stream, msg *pb.CircuitRelay) {
 	defer atomic.AddInt32(&r.streamCount, -1)
 
 	if (streamCount + liveHopCount) > int32(HopStreamLimit) {
+		r.recordRefusedHop("STREAM_LIMIT")
 		s.Reset()
 		return
 	}
 
 	src, err := peerToPeerInfo(msg.GetSrcPeer())
 	if err != nil {
-		r.handleError(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID)
+		r.refuseHop(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID)
 		return
 	}
 
 	if src.ID != s.Conn().RemotePeer() {
-		r.handleError(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID)
+		r.refuseHop(s, pb.CircuitRelay_HOP_SRC_MULTIADDR_INVALID)
 		return
 	}
 
 	dst, err := peerToPeerInfo(msg.GetDstPeer())
 	if err != nil {
-		r.handleError(s, pb.CircuitRelay_HOP_DST_MULTIADDR_INVALID)
+		r.refuseHop(s, pb.CircuitRelay_HOP_DST_MULTIADDR_INVALID)
 		return
 	}
 
 	if dst.ID == r.self {
-		r.handleError(s, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF)
+		r.refuseHop(s, pb.CircuitRelay_HOP_CANT_RELAY_TO_SELF)
 		return
 	}
 
@@ -316,9 +364,9 @@ func (r *Relay) handleHopStream(s network.Stream, msg *pb.CircuitRelay) {
 	bs, err := r.host.NewStream(ctx, dst.ID, ProtoID)
 	if err != nil {
 		if err == network.ErrNoConn {
-			r.handleError(s, pb.CircuitRelay_HOP_NO_CONN_TO_DST)
+			r.refuseHop(s, pb.CircuitRelay_HOP_NO_CONN_TO_DST)
 		} else {
-			r.handleError(s, pb.CircuitRelay_HOP_CANT_DIAL_DST)
+			r.refuseHop(s, pb.CircuitRelay_HOP_CANT_DIAL_DST)
 		}
 		return
 	}
@@ -336,7 +384,7 @@ func (r *Relay) handleHopStream(s network.Stream, msg *pb.CircuitRelay) {
 	err = wr.WriteMsg(msg)
 	if err != nil {
 		bs.Reset()
-		r.handleError(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		r.refuseHop(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
 		return
 	}
 
@@ -345,19 +393,19 @@ func (r *Relay) handleHopStream(s network.Stream, msg *pb.CircuitRelay) {
 	err = rd.ReadMsg(msg)
 	if err != nil {
 		bs.Reset()
-		r.handleError(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		r.refuseHop(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
 		return
 	}
 
 	if msg.GetType() != pb.CircuitRelay_STATUS {
 		bs.Reset()
-		r.handleError(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
+		r.refuseHop(s, pb.CircuitRelay_HOP_CANT_OPEN_DST_STREAM)
 		return
 	}
 
 	if msg.GetCode() != pb.CircuitRelay_SUCCESS {
 		bs.Reset()
-		r.handleError(s, msg.GetCode())
+		r.refuseHop(s, msg.GetCode())
 		return
 	}
 
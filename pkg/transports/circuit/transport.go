@@ -60,19 +60,19 @@ func (t *Transport) Protocols() []int {
 }
 
 // AddRelayTransport constructs a relay and adds it as a transport to the host network.
-func AddRelayTransport(ctx context.Context, h host.Host, upgrader *tptu.Upgrader, opts ...Opt) error {
+func AddRelayTransport(ctx context.Context, h host.Host, upgrader *tptu.Upgrader, opts ...Opt) (*Relay, error) {
 	_, ok := h.Network().(transport.TransportNetwork)
 	if !ok {
-		return fmt.Errorf("%v is not a transport network", h.Network())
+		return nil, fmt.Errorf("%v is not a transport network", h.Network())
 	}
 
-	_, err := NewRelay(ctx, h, upgrader, opts...)
+	r, err := NewRelay(ctx, h, upgrader, opts...)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// There's no nice way to handle these errors as we have no way to tear
 	// down the relay.
 	// TODO
-	return nil
+	return r, nil
 }
@@ -39,24 +39,32 @@ func (sm *SSMuxer) AddTransport(path string, transport sec.SecureTransport) {
 // SecureInbound secures an inbound connection using this multistream
 // multiplexed stream security transport.
 func (sm *SSMuxer) SecureInbound(ctx context.Context, insecure net.Conn) (sec.SecureConn, error) {
-	tpt, err := sm.selectProto(ctx, insecure, true)
+	proto, tpt, err := sm.selectProto(ctx, insecure, true)
 	if err != nil {
 		return nil, err
 	}
-	return tpt.SecureInbound(ctx, insecure)
+	sconn, err := tpt.SecureInbound(ctx, insecure)
+	if err != nil {
+		return nil, err
+	}
+	return &secureConn{SecureConn: sconn, protocol: proto}, nil
 }
 
 // SecureOutbound secures an outbound connection using this multistream
 // multiplexed stream security transport.
 func (sm *SSMuxer) SecureOutbound(ctx context.Context, insecure net.Conn, p peer.ID) (sec.SecureConn, error) {
-	tpt, err := sm.selectProto(ctx, insecure, false)
+	proto, tpt, err := sm.selectProto(ctx, insecure, false)
+	if err != nil {
+		return nil, err
+	}
+	sconn, err := tpt.SecureOutbound(ctx, insecure, p)
 	if err != nil {
 		return nil, err
 	}
-	return tpt.SecureOutbound(ctx, insecure, p)
+	return &secureConn{SecureConn: sconn, protocol: proto}, nil
 }
 
-func (sm *SSMuxer) selectProto(ctx context.Context, insecure net.Conn, server bool) (sec.SecureTransport, error) {
+func (sm *SSMuxer) selectProto(ctx context.Context, insecure net.Conn, server bool) (string, sec.SecureTransport, error) {
 	var proto string
 	var err error
 	done := make(chan struct{})
@@ -72,17 +80,28 @@ func (sm *SSMuxer) selectProto(ctx context.Context, insecure net.Conn, server bo
 	select {
 	case <-done:
 		if err != nil {
-			return nil, err
+			return "", nil, err
 		}
 		if tpt, ok := sm.tpts[proto]; ok {
-			return tpt, nil
+			return proto, tpt, nil
 		}
-		return nil, fmt.Errorf("selected unknown security transport")
+		return "", nil, fmt.Errorf("selected unknown security transport")
 	case <-ctx.Done():
 		// We *must* do this. We have outstanding work on the connection
 		// and it's no longer safe to use.
 		insecure.Close()
 		<-done // wait to stop using the connection.
-		return nil, ctx.Err()
+		return "", nil, ctx.Err()
 	}
 }
+
+// secureConn records the protocol negotiated for a secured connection
+type secureConn struct {
+	sec.SecureConn
+	protocol string
+}
+
+// SecurityProtocol returns the negotiated security protocol
+func (c *secureConn) SecurityProtocol() string {
+	return c.protocol
+}
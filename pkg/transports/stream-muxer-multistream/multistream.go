@@ -71,5 +71,20 @@ func (t *Transport) NewConn(nc net.Conn, isServer bool) (mux.MuxedConn, error) {
 		return nil, fmt.Errorf("selected protocol we don't have a transport for")
 	}
 
-	return tpt.NewConn(nc, isServer)
+	mconn, err := tpt.NewConn(nc, isServer)
+	if err != nil {
+		return nil, err
+	}
+	return &muxedConn{MuxedConn: mconn, protocol: proto}, nil
+}
+
+// muxedConn records the protocol negotiated for a multiplexed connection
+type muxedConn struct {
+	mux.MuxedConn
+	protocol string
+}
+
+// MuxerProtocol returns the negotiated stream multiplexer
+func (c *muxedConn) MuxerProtocol() string {
+	return c.protocol
 }
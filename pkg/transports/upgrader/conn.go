@@ -19,6 +19,24 @@ func (t *transportConn) Transport() transport.Transport {
 	return t.transport
 }
 
+// SecurityProtocol returns the negotiated security protocol, if the security
+// transport reports it
+func (t *transportConn) SecurityProtocol() string {
+	if sc, ok := t.ConnSecurity.(interface{ SecurityProtocol() string }); ok {
+		return sc.SecurityProtocol()
+	}
+	return ""
+}
+
+// MuxerProtocol returns the negotiated stream multiplexer, if the muxer
+// reports it
+func (t *transportConn) MuxerProtocol() string {
+	if mc, ok := t.MuxedConn.(interface{ MuxerProtocol() string }); ok {
+		return mc.MuxerProtocol()
+	}
+	return ""
+}
+
 func (t *transportConn) String() string {
 	ts := ""
 	if s, ok := t.transport.(fmt.Stringer); ok {
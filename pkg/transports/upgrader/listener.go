@@ -7,8 +7,10 @@ import (
 
 	"github.com/RTradeLtd/libp2px-core/transport"
 
+	connmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
 	tec "github.com/jbenet/go-temp-err-catcher"
 	manet "github.com/multiformats/go-multiaddr-net"
+	"go.uber.org/zap"
 )
 
 type listener struct {
@@ -76,6 +78,18 @@ func (l *listener) handleIncoming() {
 			return
 		}
 
+		if l.upgrader.Gater != nil {
+			if err := connmgr.NewGateError(connmgr.GateAccept, l.upgrader.Gater.InterceptAccept(maconn)); err != nil {
+				// refused before spending any effort on the upgrade
+				if l.upgrader.Logger != nil {
+					l.upgrader.Logger.Debug("refused inbound connection",
+						zap.String("address", maconn.RemoteMultiaddr().String()), zap.Error(err))
+				}
+				maconn.Close()
+				continue
+			}
+		}
+
 		// The go routine below calls Release when the context is
 		// canceled so there's no need to wait on it here.
 		l.threshold.Wait()
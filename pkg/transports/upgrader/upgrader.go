@@ -7,13 +7,16 @@ import (
 	"net"
 
 	"github.com/RTradeLtd/libp2px-core/mux"
+	"github.com/RTradeLtd/libp2px-core/network"
 	"github.com/RTradeLtd/libp2px-core/peer"
 	"github.com/RTradeLtd/libp2px-core/pnet"
 	"github.com/RTradeLtd/libp2px-core/sec"
 	"github.com/RTradeLtd/libp2px-core/transport"
 
+	connmgr "github.com/RTradeLtd/libp2px/pkg/connmgr"
 	filter "github.com/RTradeLtd/libp2px/pkg/utils/filter"
 	manet "github.com/multiformats/go-multiaddr-net"
+	"go.uber.org/zap"
 )
 
 // ErrNilPeer is returned when attempting to upgrade an outbound connection
@@ -30,6 +33,11 @@ type Upgrader struct {
 	Secure    sec.SecureTransport
 	Muxer     mux.Multiplexer
 	Filters   *filter.Filters
+	// Gater is consulted on accepted connections before the upgrade, and on
+	// every connection once the remote peer is authenticated (optional)
+	Gater connmgr.ConnectionGater
+	// Logger records the inbound connections refused by the gater (optional)
+	Logger *zap.Logger
 }
 
 // UpgradeListener upgrades the passed multiaddr-net listener into a full libp2p-transport listener.
@@ -85,6 +93,16 @@ func (u *Upgrader) upgrade(ctx context.Context, t transport.Transport, maconn ma
 		conn.Close()
 		return nil, fmt.Errorf("failed to negotiate security protocol: %s", err)
 	}
+	if u.Gater != nil {
+		dir := network.DirInbound
+		if p != "" {
+			dir = network.DirOutbound
+		}
+		if err := connmgr.NewGateError(connmgr.GateSecured, u.Gater.InterceptSecured(dir, sconn.RemotePeer(), maconn)); err != nil {
+			sconn.Close()
+			return nil, err
+		}
+	}
 	smconn, err := u.setupMuxer(ctx, sconn, p)
 	if err != nil {
 		sconn.Close()